@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dghubble/sling"
+	"github.com/estesp/mquery/pkg/inspect"
+)
+
+// backendBatchSize matches the maximum number of images the backend accepts
+// in a single batch request; longer lists are sent in several requests
+const backendBatchSize = 100
+
+var (
+	imageFile = flag.String("file", "", "read image names, one per line, from a file ('-' for stdin)")
+	workers   = flag.Int("workers", 8, "number of concurrent registry queries for multiple images with --direct")
+)
+
+// imageNames returns the images named on the command line followed by any
+// listed in the --file input
+func imageNames() ([]string, error) {
+	images := flag.Args()
+	if *imageFile == "" {
+		return images, nil
+	}
+	var r io.Reader = os.Stdin
+	if *imageFile != "-" {
+		f, err := os.Open(*imageFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	list, err := readImageList(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image list: %w", err)
+	}
+	return append(images, list...), nil
+}
+
+// readImageList reads one image name per line, skipping blank lines and
+// lines starting with '#'
+func readImageList(r io.Reader) ([]string, error) {
+	var images []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		images = append(images, line)
+	}
+	return images, scanner.Err()
+}
+
+// queryDirectBatch queries each image's registry from this process using a
+// bounded number of concurrent lookups
+func queryDirectBatch(images []string) int {
+	return outputResults(directResults(images))
+}
+
+// queryBackendBatch POSTs the image list to the backend batch endpoint
+func queryBackendBatch(client *sling.Sling, images []string) int {
+	results, rc, err := backendResults(client, images)
+	if err != nil {
+		printError("%v\n", err)
+		return rc
+	}
+	return outputResults(results)
+}
+
+// queryResults queries the images directly or through the backend, as
+// selected by --direct; if the backend request itself failed, the error is
+// returned, unreported, with its exit code
+func queryResults(images []string) ([]inspect.Result, int, error) {
+	if *direct {
+		return directResults(images), exitOK, nil
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return nil, exitError, fmt.Errorf("failed to load config: %w", err)
+	}
+	return backendResults(newBackendClient(resolveEndpoint(*endpoint, cfg), cfg, images), images)
+}
+
+func directResults(images []string) []inspect.Result {
+	opts := directOptions(images...)
+	results := inspect.Batch(images, *workers, func(name string) (*inspect.Image, error) {
+		// --timeout applies to each image, not the whole batch
+		ctx, cancel := queryContext()
+		defer cancel()
+		return inspect.QueryRegistry(ctx, name, opts)
+	})
+	printRateLimit(lowestRateLimit(results))
+	return results
+}
+
+func backendResults(client *sling.Sling, images []string) ([]inspect.Result, int, error) {
+	var results []inspect.Result
+	for start := 0; start < len(images); start += backendBatchSize {
+		end := min(start+backendBatchSize, len(images))
+		var batch []inspect.Result
+		errResp := new(ErrorResponse)
+		resp, err := client.New().Post("").QueryStruct(queryParams("")).BodyJSON(images[start:end]).Receive(&batch, errResp)
+		if err != nil {
+			rc, err := backendFailure(err)
+			return nil, rc, err
+		}
+		if resp.StatusCode != 200 {
+			return nil, exitError, fmt.Errorf("%s", errResp.Error)
+		}
+		results = append(results, batch...)
+	}
+	printRateLimit(lowestRateLimit(results))
+	return results, exitOK, nil
+}
+
+// outputResults prints the batch results and returns a non-zero exit code if
+// any image could not be queried or lacks a required platform
+func outputResults(results []inspect.Result) int {
+	if err := printResults(results); err != nil {
+		printError("failed to print image information: %v\n", err)
+		return exitError
+	}
+	return resultsExitCode(results)
+}
+
+// resultsExitCode returns exitError if any image could not be queried, or
+// else exitMissingPlatforms if any image lacks a required platform
+func resultsExitCode(results []inspect.Result) int {
+	rc := exitOK
+	for _, result := range results {
+		if result.Error != "" {
+			rc = exitError
+			continue
+		}
+		if !checkRequired(result.Name, result.Image) && rc == exitOK {
+			rc = exitMissingPlatforms
+		}
+	}
+	return rc
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// endpointEnv overrides the backend endpoint when no --endpoint flag is given
+	endpointEnv = "MQUERY_ENDPOINT"
+	// configEnv overrides the default location of the mquery config file
+	configEnv = "MQUERY_CONFIG"
+)
+
+// Config holds the settings that can be persisted in the mquery config file
+type Config struct {
+	Endpoint string            `json:"endpoint,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+}
+
+// headerFlags collects repeated "--header 'Name: value'" flags
+type headerFlags map[string]string
+
+func (h headerFlags) String() string {
+	var hdrs []string
+	for k, v := range h {
+		hdrs = append(hdrs, k+": "+v)
+	}
+	return strings.Join(hdrs, ", ")
+}
+
+func (h headerFlags) Set(value string) error {
+	name, val, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" {
+		return fmt.Errorf("header %q must be in the form 'Name: value'", value)
+	}
+	h[strings.TrimSpace(name)] = strings.TrimSpace(val)
+	return nil
+}
+
+// defaultConfigPath returns the location of the config file when it is not
+// specified on the command line or in the environment
+func defaultConfigPath() string {
+	if path := os.Getenv(configEnv); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "mquery", "config.json")
+}
+
+// loadConfig reads the config file at path; a missing file is not an error
+// and results in an empty configuration
+func loadConfig(path string) (*Config, error) {
+	cfg := &Config{}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cfg, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("can't parse config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// resolveEndpoint picks the backend endpoint, in order of precedence, from the
+// command line, the environment, the config file and finally the built-in default
+func resolveEndpoint(flagValue string, cfg *Config) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if env := os.Getenv(endpointEnv); env != "" {
+		return env
+	}
+	if cfg.Endpoint != "" {
+		return cfg.Endpoint
+	}
+	return baseURL
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/estesp/mquery/pkg/inspect"
+)
+
+// diffResult is the output of the diff command
+type diffResult struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	inspect.Diff
+}
+
+// diffCommand compares the platforms of two images, returning
+// exitDifferences if they differ
+func diffCommand(args []string) int {
+	if err := parseSubcommand(args, "diff IMAGE_A IMAGE_B", 2); err != nil {
+		printError("%v\n", err)
+		return exitError
+	}
+	if err := validateOutput(); err != nil {
+		printError("%v\n", err)
+		return exitError
+	}
+	if *outputFormat == outputTable && *formatTmpl == "" {
+		printError("table output is not supported by diff\n")
+		return exitError
+	}
+	results, rc, err := queryResults(args)
+	if err != nil {
+		printError("%v\n", err)
+		return rc
+	}
+	for _, result := range results {
+		if result.Error != "" {
+			return reportError(result.Name, result.Code, result.Error)
+		}
+	}
+	diff := diffResult{
+		From: results[0].Name,
+		To:   results[1].Name,
+		Diff: inspect.Compare(results[0].Image, results[1].Image),
+	}
+	if err := printDiff(diff); err != nil {
+		printError("failed to print differences: %v\n", err)
+		return exitError
+	}
+	if diff.Changed() {
+		return exitDifferences
+	}
+	return exitOK
+}
+
+// printDiff writes the differences to stdout in the selected format
+func printDiff(diff diffResult) error {
+	if rendered, err := render(diff); rendered || err != nil {
+		return err
+	}
+	printDiffText(diff)
+	return nil
+}
+
+// printDiffText prints one line per platform, marked '+' if only in the
+// second image, '-' if only in the first, '~' if its manifest changed and
+// '=' if unchanged
+func printDiffText(diff diffResult) {
+	fmt.Printf("Comparing %s with %s\n", diff.From, diff.To)
+	for _, p := range diff.Removed {
+		fmt.Printf(" - %s\n", parsePlatform(p))
+	}
+	for _, p := range diff.Added {
+		fmt.Printf(" + %s\n", parsePlatform(p))
+	}
+	for _, c := range diff.Common {
+		if c.Changed {
+			fmt.Printf(" ~ %s (digest: %s -> %s)\n", parsePlatform(c.Platform), c.FromDigest, c.ToDigest)
+		} else {
+			fmt.Printf(" = %s\n", parsePlatform(c.Platform))
+		}
+	}
+	if !diff.Changed() {
+		fmt.Println("No differences")
+	}
+}
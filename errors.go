@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/estesp/mquery/pkg/inspect"
+)
+
+// printError prints an ERROR line where it can't be mistaken for the output
+// (see errorOutput)
+func printError(format string, a ...interface{}) {
+	fmt.Fprintf(errorOutput(), "ERROR: "+format, a...)
+}
+
+// reportError prints a message for the failed image query explaining the
+// error code, followed by the underlying error, and returns the exit code
+func reportError(imageName string, code inspect.ErrorCode, msg string) int {
+	rc := exitError
+	switch code {
+	case inspect.CodeNotFound:
+		printError("image %s not found; check the repository name and tag\n", imageName)
+		rc = exitNotFound
+	case inspect.CodeUnauthorized, inspect.CodeDenied:
+		printError("access to %s was denied; for a private image, use --registry-token, or --direct with registry credentials\n", imageName)
+		rc = exitUnauthorized
+	case inspect.CodeRateLimited:
+		printError("the registry for %s is rate limiting requests; try again later\n", imageName)
+		rc = exitRegistryError
+	case inspect.CodeUnavailable:
+		printError("the registry for %s is unavailable\n", imageName)
+		rc = exitRegistryError
+	case inspect.CodeTimeout:
+		printError("timed out querying the registry for %s\n", imageName)
+		rc = exitTimeout
+	case inspect.CodeUnsupportedMediaType:
+		printError("%s has a manifest type mquery does not support\n", imageName)
+		rc = exitUnsupported
+	}
+	printError("%s\n", msg)
+	return rc
+}
+
+// backendError reports a failed request to the backend and returns the exit
+// code
+func backendError(err error) int {
+	rc, err := backendFailure(err)
+	printError("%v\n", err)
+	return rc
+}
+
+// backendFailure returns the exit code and error for a failed request to the
+// backend; a request that outlasted --timeout is a timeout
+func backendFailure(err error) (int, error) {
+	if isTimeout(err) {
+		return exitTimeout, fmt.Errorf("timed out waiting for the backend: %w", err)
+	}
+	return exitError, fmt.Errorf("failed to query backend: %w", err)
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// statusCode maps a backend HTTP status to an error code for backends that
+// don't return one
+func statusCode(status int) inspect.ErrorCode {
+	switch status {
+	case http.StatusNotFound:
+		return inspect.CodeNotFound
+	case http.StatusUnauthorized:
+		return inspect.CodeUnauthorized
+	case http.StatusForbidden:
+		return inspect.CodeDenied
+	case http.StatusTooManyRequests:
+		return inspect.CodeRateLimited
+	case http.StatusBadGateway:
+		return inspect.CodeUnavailable
+	case http.StatusGatewayTimeout:
+		return inspect.CodeTimeout
+	case http.StatusUnsupportedMediaType:
+		return inspect.CodeUnsupportedMediaType
+	}
+	return inspect.CodeInternal
+}
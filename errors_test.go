@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/estesp/mquery/pkg/inspect"
+)
+
+func TestReportError(t *testing.T) {
+	// discard the error messages
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+	stdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = stdout }()
+
+	tests := []struct {
+		code inspect.ErrorCode
+		want int
+	}{
+		{inspect.CodeInvalidName, exitError},
+		{inspect.CodeNotFound, exitNotFound},
+		{inspect.CodeUnauthorized, exitUnauthorized},
+		{inspect.CodeDenied, exitUnauthorized},
+		{inspect.CodeRateLimited, exitRegistryError},
+		{inspect.CodeUnavailable, exitRegistryError},
+		{inspect.CodeTimeout, exitTimeout},
+		{inspect.CodeUnsupportedMediaType, exitUnsupported},
+		{inspect.CodeInternal, exitError},
+	}
+	for _, tt := range tests {
+		if got := reportError("alpine", tt.code, "failed"); got != tt.want {
+			t.Errorf("reportError for %s = %d, want %d", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		status int
+		want   inspect.ErrorCode
+	}{
+		{http.StatusNotFound, inspect.CodeNotFound},
+		{http.StatusUnauthorized, inspect.CodeUnauthorized},
+		{http.StatusForbidden, inspect.CodeDenied},
+		{http.StatusTooManyRequests, inspect.CodeRateLimited},
+		{http.StatusBadGateway, inspect.CodeUnavailable},
+		{http.StatusGatewayTimeout, inspect.CodeTimeout},
+		{http.StatusUnsupportedMediaType, inspect.CodeUnsupportedMediaType},
+		{http.StatusBadRequest, inspect.CodeInternal},
+		{http.StatusInternalServerError, inspect.CodeInternal},
+	}
+	for _, tt := range tests {
+		if got := statusCode(tt.status); got != tt.want {
+			t.Errorf("statusCode(%d) = %s, want %s", tt.status, got, tt.want)
+		}
+	}
+}
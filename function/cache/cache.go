@@ -0,0 +1,89 @@
+// Package cache provides the image metadata caches used by the mquery backend
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/estesp/mquery/pkg/inspect"
+)
+
+// ErrNotFound is returned by Get when there is no cached entry for a key
+var ErrNotFound = errors.New("image not found in cache")
+
+// Cache stores image query results by image reference
+type Cache interface {
+	// Get returns the cached image for key, or ErrNotFound
+	Get(key string) (*inspect.Image, error)
+	// Put stores image under key, replacing any existing entry
+	Put(key string, image *inspect.Image) error
+}
+
+// supported cache backends
+const (
+	BackendDynamoDB = "dynamodb"
+	BackendMemory   = "memory"
+	BackendFile     = "file"
+	BackendNone     = "none"
+)
+
+// Config selects and configures a cache backend
+type Config struct {
+	// Backend is one of the Backend* constants; defaults to DynamoDB
+	Backend string
+	// Table is the DynamoDB table name
+	Table string
+	// Region is the AWS region of the DynamoDB table
+	Region string
+	// Size is the maximum number of entries held by the memory cache
+	Size int
+	// Dir is the directory used by the file cache
+	Dir string
+}
+
+// ConfigFromEnv reads the cache configuration from the environment:
+// MQUERY_CACHE selects the backend, MQUERY_CACHE_TABLE the DynamoDB table,
+// MQUERY_CACHE_SIZE the memory cache size and MQUERY_CACHE_DIR the file cache
+// directory. The DynamoDB region is taken from AWS_REGION.
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Backend: os.Getenv("MQUERY_CACHE"),
+		Table:   os.Getenv("MQUERY_CACHE_TABLE"),
+		Region:  os.Getenv("AWS_REGION"),
+		Dir:     os.Getenv("MQUERY_CACHE_DIR"),
+	}
+	if size := os.Getenv("MQUERY_CACHE_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid MQUERY_CACHE_SIZE %q: %w", size, err)
+		}
+		cfg.Size = n
+	}
+	return cfg, nil
+}
+
+// New creates the cache backend selected by cfg
+func New(cfg Config) (Cache, error) {
+	switch cfg.Backend {
+	case "", BackendDynamoDB:
+		return NewDynamoDB(cfg.Region, cfg.Table)
+	case BackendMemory:
+		return NewMemory(cfg.Size), nil
+	case BackendFile:
+		return NewFile(cfg.Dir)
+	case BackendNone:
+		return None{}, nil
+	}
+	return nil, fmt.Errorf("unknown cache backend %q", cfg.Backend)
+}
+
+// None is a cache that never stores anything
+type None struct{}
+
+// Get always returns ErrNotFound
+func (None) Get(key string) (*inspect.Image, error) { return nil, ErrNotFound }
+
+// Put discards the image
+func (None) Put(key string, image *inspect.Image) error { return nil }
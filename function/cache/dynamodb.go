@@ -0,0 +1,95 @@
+package cache
+
+import (
+	"errors"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+
+	"github.com/estesp/mquery/pkg/inspect"
+)
+
+// DefaultTable is the DynamoDB table used when none is configured
+const DefaultTable = "imagecache"
+
+// keyAttribute is the hash key of the DynamoDB table
+const keyAttribute = "imagename"
+
+// DynamoDB caches images in a DynamoDB table keyed by "imagename"
+type DynamoDB struct {
+	client dynamodbiface.DynamoDBAPI
+	table  string
+}
+
+// NewDynamoDB creates a DynamoDB cache for the table in the given AWS region
+func NewDynamoDB(region, table string) (*DynamoDB, error) {
+	awsSession, err := session.NewSession(&aws.Config{
+		Region: aws.String(region)},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return NewDynamoDBWithClient(dynamodb.New(awsSession), table), nil
+}
+
+// NewDynamoDBWithClient creates a DynamoDB cache using an existing client
+func NewDynamoDBWithClient(client dynamodbiface.DynamoDBAPI, table string) *DynamoDB {
+	if table == "" {
+		table = DefaultTable
+	}
+	return &DynamoDB{client: client, table: table}
+}
+
+// Get returns the cached image for key
+func (d *DynamoDB) Get(key string) (*inspect.Image, error) {
+	input := &dynamodb.GetItemInput{
+		Key:       itemKey(key),
+		TableName: aws.String(d.table),
+	}
+
+	result, err := d.client.GetItem(input)
+	if err != nil {
+		return nil, errors.New("failed to find image")
+	}
+	if len(result.Item) == 0 {
+		return nil, ErrNotFound
+	}
+
+	item := new(inspect.Image)
+	err = dynamodbattribute.UnmarshalMap(result.Item, item)
+	if err != nil {
+		return nil, errors.New("failed to unmarshal image cached details")
+	}
+	return item, nil
+}
+
+// Put stores image under key
+func (d *DynamoDB) Put(key string, image *inspect.Image) error {
+	av, err := dynamodbattribute.MarshalMap(image)
+	if err != nil {
+		return errors.New("could not marshal image data")
+	}
+	av[keyAttribute] = &dynamodb.AttributeValue{S: aws.String(key)}
+
+	input := &dynamodb.PutItemInput{
+		Item:      av,
+		TableName: aws.String(d.table),
+	}
+
+	_, err = d.client.PutItem(input)
+	if err != nil {
+		return errors.New("could not write to dynamoDB")
+	}
+	return nil
+}
+
+func itemKey(key string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		keyAttribute: {
+			S: aws.String(key),
+		},
+	}
+}
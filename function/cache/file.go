@@ -0,0 +1,78 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	"github.com/estesp/mquery/pkg/inspect"
+)
+
+// File caches each image as a JSON file in a local directory
+type File struct {
+	dir string
+}
+
+// NewFile creates a file cache in dir, creating the directory if needed;
+// dir defaults to an "mquery" directory in the user's cache directory
+func NewFile(dir string) (*File, error) {
+	if dir == "" {
+		userDir, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(userDir, "mquery")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &File{dir: dir}, nil
+}
+
+// Get returns the cached image for key
+func (f *File) Get(key string) (*inspect.Image, error) {
+	data, err := os.ReadFile(f.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	image := new(inspect.Image)
+	if err := json.Unmarshal(data, image); err != nil {
+		return nil, errors.New("failed to unmarshal image cached details")
+	}
+	return image, nil
+}
+
+// Put stores image under key; the file is written atomically so concurrent
+// readers never see a partial entry
+func (f *File) Put(key string, image *inspect.Image) error {
+	data, err := json.Marshal(image)
+	if err != nil {
+		return errors.New("could not marshal image data")
+	}
+	tmp, err := os.CreateTemp(f.dir, ".entry-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), f.path(key))
+}
+
+// path maps a key to a file name; keys are image references which may
+// contain characters that aren't valid in file names, so they are hashed
+func (f *File) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(f.dir, hex.EncodeToString(sum[:])+".json")
+}
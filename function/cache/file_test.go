@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"os"
+	"testing"
+
+	"github.com/estesp/mquery/pkg/inspect"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestFileRoundTrip(t *testing.T) {
+	f, err := NewFile(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := "docker.io/library/alpine:latest"
+	if _, err := f.Get(key); err != ErrNotFound {
+		t.Fatalf("Get of a missing entry = %v, want %v", err, ErrNotFound)
+	}
+
+	image := &inspect.Image{
+		ImageName: key,
+		Digest:    "sha256:1111111111111111111111111111111111111111111111111111111111111111",
+		IsList:    true,
+		ArchList:  []ocispec.Platform{{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		CacheTS:   1700000000,
+	}
+	for _, digest := range []string{"sha256:0000", image.Digest} {
+		// the second Put overwrites the first
+		entry := *image
+		entry.Digest = digest
+		if err := f.Put(key, &entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := f.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ImageName != image.ImageName || got.Digest != image.Digest || !got.IsList || got.CacheTS != image.CacheTS {
+		t.Errorf("Get = %+v, want %+v", got, image)
+	}
+	if len(got.ArchList) != 1 || got.ArchList[0].Variant != "v8" {
+		t.Errorf("Get platforms = %+v, want %+v", got.ArchList, image.ArchList)
+	}
+
+	// no temporary files are left behind
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("cache directory has %d files, want 1", len(entries))
+	}
+}
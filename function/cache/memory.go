@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/estesp/mquery/pkg/inspect"
+)
+
+// DefaultMemorySize is the number of entries held by a memory cache when no
+// size is configured
+const DefaultMemorySize = 1024
+
+// Memory is an in-process least-recently-used cache
+type Memory struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	image *inspect.Image
+}
+
+// NewMemory creates a memory cache holding at most size entries
+func NewMemory(size int) *Memory {
+	if size <= 0 {
+		size = DefaultMemorySize
+	}
+	return &Memory{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+// Get returns the cached image for key, marking it as recently used
+func (m *Memory) Get(key string) (*inspect.Image, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	m.order.MoveToFront(elem)
+	image := *elem.Value.(*memoryEntry).image
+	return &image, nil
+}
+
+// Put stores image under key, evicting the least recently used entry if the
+// cache is full
+func (m *Memory) Put(key string, image *inspect.Image) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := *image
+	if elem, ok := m.entries[key]; ok {
+		elem.Value.(*memoryEntry).image = &stored
+		m.order.MoveToFront(elem)
+		return nil
+	}
+	m.entries[key] = m.order.PushFront(&memoryEntry{key: key, image: &stored})
+	if m.order.Len() > m.size {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/estesp/mquery/pkg/inspect"
+)
+
+// put stores the image, failing the test if it can't
+func put(t *testing.T, m Cache, key string, image *inspect.Image) {
+	t.Helper()
+	if err := m.Put(key, image); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMemoryEviction(t *testing.T) {
+	m := NewMemory(2)
+	put(t, m, "a", &inspect.Image{Digest: "a"})
+	put(t, m, "b", &inspect.Image{Digest: "b"})
+	// reading a makes b the least recently used entry
+	if _, err := m.Get("a"); err != nil {
+		t.Fatal(err)
+	}
+	put(t, m, "c", &inspect.Image{Digest: "c"})
+
+	if _, err := m.Get("b"); err != ErrNotFound {
+		t.Errorf("Get(b) after eviction = %v, want %v", err, ErrNotFound)
+	}
+	for _, key := range []string{"a", "c"} {
+		image, err := m.Get(key)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", key, err)
+		}
+		if image.Digest != key {
+			t.Errorf("Get(%s) digest = %s, want %s", key, image.Digest, key)
+		}
+	}
+}
+
+func TestMemoryOverwrite(t *testing.T) {
+	m := NewMemory(2)
+	put(t, m, "a", &inspect.Image{Digest: "old"})
+	put(t, m, "b", &inspect.Image{Digest: "b"})
+	// overwriting a doesn't add an entry, and makes it the most recently used
+	put(t, m, "a", &inspect.Image{Digest: "new"})
+	put(t, m, "c", &inspect.Image{Digest: "c"})
+
+	image, err := m.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image.Digest != "new" {
+		t.Errorf("Get(a) digest = %s, want new", image.Digest)
+	}
+	if _, err := m.Get("b"); err != ErrNotFound {
+		t.Errorf("Get(b) after eviction = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestMemoryCopies(t *testing.T) {
+	m := NewMemory(0)
+	image := &inspect.Image{Digest: "a"}
+	put(t, m, "a", image)
+	// neither the stored nor the returned image is shared with the caller
+	image.Digest = "changed"
+	got, err := m.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Digest = "changed"
+	if got, _ := m.Get("a"); got.Digest != "a" {
+		t.Errorf("cached digest = %s, want a", got.Digest)
+	}
+}
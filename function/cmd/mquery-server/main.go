@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/estesp/mquery/function/cache"
+	"github.com/estesp/mquery/function/service"
+	"github.com/estesp/mquery/pkg/telemetry"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// server timeouts; the write timeout bounds the whole request, so it must
+// allow for slow registries and large batch requests
+const (
+	readHeaderTimeout = 10 * time.Second
+	readTimeout       = 30 * time.Second
+	writeTimeout      = 5 * time.Minute
+	// shutdownTimeout is how long in-flight requests may take to finish
+	// after a SIGTERM or interrupt
+	shutdownTimeout = 30 * time.Second
+)
+
+func main() {
+	listen := flag.String("listen", ":8080", "address to listen on")
+	flag.Parse()
+
+	cfg, err := cache.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("invalid cache configuration: %v", err)
+	}
+	if cfg.Backend == "" {
+		// unlike the Lambda function, the standalone server doesn't assume
+		// it is running in AWS
+		cfg.Backend = cache.BackendMemory
+	}
+	imageCache, err := cache.New(cfg)
+	if err != nil {
+		log.Fatalf("unable to create %q image cache: %v", cfg.Backend, err)
+	}
+
+	shutdown, err := telemetry.Setup(context.Background(), "mquery-backend")
+	if err != nil {
+		log.Fatalf("invalid tracing configuration: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	// otelhttp continues the client's trace from the W3C traceparent header
+	mux.Handle("/mquery", otelhttp.NewHandler(service.New(imageCache, service.ConfigFromEnv()), "mquery"))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	server := &http.Server{
+		Addr:              *listen,
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+	}
+	// a pod is stopped with SIGTERM; finish the in-flight requests and flush
+	// their spans before exiting
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		log.Println("shutting down")
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+	}()
+
+	log.Printf("mquery server listening on %s (cache: %s)", *listen, cfg.Backend)
+	rc := 0
+	if err := server.ListenAndServe(); errors.Is(err, http.ErrServerClosed) {
+		// ListenAndServe returns as soon as Shutdown starts
+		<-drained
+	} else {
+		log.Println(err)
+		rc = 1
+	}
+	if err := shutdown(context.Background()); err != nil {
+		log.Printf("failed to flush traces: %v", err)
+	}
+	os.Exit(rc)
+}
@@ -1,230 +1,85 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
-	"errors"
-	"fmt"
 	"log"
 	"net/http"
-	"os"
+	"net/url"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 
-	"github.com/estesp/manifest-tool/v2/pkg/registry"
-	"github.com/estesp/manifest-tool/v2/pkg/store"
-	"github.com/estesp/manifest-tool/v2/pkg/types"
-	"github.com/estesp/manifest-tool/v2/pkg/util"
-
-	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
-)
-
-const (
-	cacheTimeout = time.Hour
-)
-
-var (
-	tableName  = "imagecache"
-	dynaClient dynamodbiface.DynamoDBAPI
+	"github.com/estesp/mquery/function/cache"
+	"github.com/estesp/mquery/function/service"
+	"github.com/estesp/mquery/pkg/telemetry"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
 )
 
-// ErrorBody is used to encapsulate error responses to the client
-type ErrorBody struct {
-	ErrorMsg *string `json:"error,omitempty"`
-}
+// responseMargin is the time reserved before the Lambda deadline to return a
+// timeout error rather than being stopped without a response
+const responseMargin = time.Second
 
-// Image represents the cached JSON metadata about the image
-type Image struct {
-	CacheTS   int64              `json:"cachets"`
-	IsList    bool               `json:"islist"`
-	ImageName string             `json:"imagename"`
-	Digest    string             `json:"digest"`
-	MediaType string             `json:"mediatype"`
-	ArchList  []ocispec.Platform `json:"archlist"`
-}
+var svc *service.Service
 
 func main() {
-	region := os.Getenv("AWS_REGION")
-	awsSession, err := session.NewSession(&aws.Config{
-		Region: aws.String(region)},
-	)
+	cfg, err := cache.ConfigFromEnv()
 	if err != nil {
-		return
+		log.Fatalf("invalid cache configuration: %v", err)
 	}
-	dynaClient = dynamodb.New(awsSession)
-	lambda.Start(handleRequest)
-}
-
-func inspectImage(req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
-	imageName := req.QueryStringParameters["image"]
-	if len(imageName) == 0 {
-		return apiResponse(http.StatusBadRequest, ErrorBody{aws.String("No image name provided")})
-	}
-	// check cache
-	if image, err := checkCache(imageName); err == nil {
-		return apiResponse(http.StatusOK, image)
-	}
-	// inspect image
-	image, err := queryRegistry(imageName)
+	imageCache, err := cache.New(cfg)
 	if err != nil {
-		return apiResponse(http.StatusBadRequest, ErrorBody{aws.String(fmt.Sprintf("Error querying image: %s", err))})
+		log.Fatalf("unable to create %q image cache: %v", cfg.Backend, err)
 	}
-	if err = cacheImage(image); err != nil {
-		log.Printf("WARN: unable to cache image: %v", err)
+	if _, err := telemetry.Setup(context.Background(), "mquery-backend"); err != nil {
+		log.Fatalf("invalid tracing configuration: %v", err)
 	}
-
-	return apiResponse(http.StatusOK, image)
+	svc = service.New(imageCache, service.ConfigFromEnv())
+	lambda.Start(handleRequest)
 }
 
-func handleRequest(req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
-	switch req.HTTPMethod {
-	case "GET":
-		return inspectImage(req)
+// handleRequest adapts the API Gateway proxy request to the mquery service
+func handleRequest(ctx context.Context, req events.APIGatewayProxyRequest) (*events.APIGatewayProxyResponse, error) {
+	sreq := service.Request{
+		Method: req.HTTPMethod,
+		Query:  url.Values{},
+		Header: http.Header{},
+		Body:   []byte(req.Body),
+	}
+	for k, v := range req.QueryStringParameters {
+		sreq.Query.Set(k, v)
+	}
+	// API Gateway passes through header names as sent by the client; setting
+	// them on an http.Header canonicalizes them for case-insensitive lookup
+	for k, v := range req.Headers {
+		sreq.Header.Set(k, v)
+	}
+	if req.IsBase64Encoded {
+		body, err := base64.StdEncoding.DecodeString(req.Body)
+		if err != nil {
+			return apiResponse(service.BadRequest("Unable to decode request body"))
+		}
+		sreq.Body = body
 	}
-	return apiResponse(http.StatusMethodNotAllowed, "method not allowed")
+	// continue the client's trace, if any
+	ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier(sreq.Header))
+	defer telemetry.Flush(context.Background())
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline.Add(-responseMargin))
+		defer cancel()
+	}
+	return apiResponse(svc.Handle(ctx, sreq))
 }
 
-func apiResponse(status int, body interface{}) (*events.APIGatewayProxyResponse, error) {
+func apiResponse(sresp service.Response) (*events.APIGatewayProxyResponse, error) {
 	resp := events.APIGatewayProxyResponse{Headers: map[string]string{"Content-Type": "application/json"}}
-	resp.StatusCode = status
+	resp.StatusCode = sresp.Status
 
-	stringBody, _ := json.Marshal(body)
+	stringBody, _ := json.Marshal(sresp.Body)
 	resp.Body = string(stringBody)
 	return &resp, nil
 }
-
-func checkCache(imageName string) (*Image, error) {
-	input := &dynamodb.GetItemInput{
-		Key: map[string]*dynamodb.AttributeValue{
-			"imagename": {
-				S: aws.String(imageName),
-			},
-		},
-		TableName: aws.String(tableName),
-	}
-
-	result, err := dynaClient.GetItem(input)
-	if err != nil {
-		return nil, errors.New("failed to find image")
-	}
-
-	item := new(Image)
-	err = dynamodbattribute.UnmarshalMap(result.Item, item)
-	if err != nil {
-		return nil, errors.New("failed to unmarshal image cached details")
-	}
-	cacheTime := time.Unix(item.CacheTS, 0)
-	if cacheTime.Add(cacheTimeout).Before(time.Now()) {
-		// invalidate
-		deleteCache(imageName)
-		return nil, errors.New("Cache expired image " + imageName)
-	}
-	return item, nil
-}
-
-func deleteCache(imageName string) {
-	input := &dynamodb.DeleteItemInput{
-		Key: map[string]*dynamodb.AttributeValue{
-			"imagename": {
-				S: aws.String(imageName),
-			},
-		},
-		TableName: aws.String(tableName),
-	}
-
-	if _, err := dynaClient.DeleteItem(input); err != nil {
-		log.Printf("error deleting cache item for %s: %v", imageName, err)
-	}
-}
-
-func cacheImage(image *Image) error {
-	av, err := dynamodbattribute.MarshalMap(image)
-	if err != nil {
-		return errors.New("could not marshal image data")
-	}
-
-	input := &dynamodb.PutItemInput{
-		Item:      av,
-		TableName: aws.String(tableName),
-	}
-
-	_, err = dynaClient.PutItem(input)
-	if err != nil {
-		return errors.New("could not write to dynamoDB")
-	}
-	return nil
-}
-
-func queryRegistry(name string) (*Image, error) {
-	var image *Image
-	imageRef, err := util.ParseName(name)
-	if err != nil {
-		return nil, err
-	}
-
-	memoryStore := store.NewMemoryStore()
-	if err = util.CreateRegistryHost(imageRef, "", "", false, false, "", false); err != nil {
-		return nil, err
-	}
-
-	descriptor, err := registry.FetchDescriptor(util.GetResolver(), memoryStore, imageRef)
-	if err != nil {
-		return nil, err
-	}
-
-	_, db, _ := memoryStore.Get(descriptor)
-	switch descriptor.MediaType {
-	case ocispec.MediaTypeImageIndex, types.MediaTypeDockerSchema2ManifestList:
-		// this is a multi-platform image descriptor; marshal to Index type
-		var idx ocispec.Index
-		if err := json.Unmarshal(db, &idx); err != nil {
-			return nil, err
-		}
-		image = generateImage(name, memoryStore, descriptor, idx, ocispec.Image{})
-	case ocispec.MediaTypeImageManifest, types.MediaTypeDockerSchema2Manifest:
-		var man ocispec.Manifest
-		if err := json.Unmarshal(db, &man); err != nil {
-			return nil, err
-		}
-		_, cb, _ := memoryStore.Get(man.Config)
-		var conf ocispec.Image
-		if err := json.Unmarshal(cb, &conf); err != nil {
-			return nil, err
-		}
-		image = generateImage(name, memoryStore, descriptor, ocispec.Index{}, conf)
-		return image, nil
-	default:
-		return nil, errors.New("Unknown descriptor type: " + descriptor.MediaType)
-	}
-	return image, nil
-}
-
-func generateImage(name string, cs *store.MemoryStore, desc ocispec.Descriptor, index ocispec.Index, imgConfig ocispec.Image) *Image {
-	image := new(Image)
-	image.Digest = desc.Digest.String()
-	image.MediaType = desc.MediaType
-	image.ImageName = name
-	image.CacheTS = time.Now().Unix()
-	switch desc.MediaType {
-	case ocispec.MediaTypeImageIndex, types.MediaTypeDockerSchema2ManifestList:
-		image.IsList = true
-		for _, img := range index.Manifests {
-			// skip outputting the "fake" attestation entries in the manifest list
-			if _, ok := img.Annotations["vnd.docker.reference.type"]; !ok {
-				image.ArchList = append(image.ArchList, *img.Platform)
-			}
-		}
-	default:
-		image.ArchList = []ocispec.Platform{{
-			OS:           imgConfig.OS,
-			Architecture: imgConfig.Architecture,
-		}}
-	}
-	return image
-}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"os"
+	"strings"
+)
+
+// insecureRegistriesEnv lists the registries the backend accesses without
+// TLS verification, falling back to plain HTTP
+const insecureRegistriesEnv = "MQUERY_INSECURE_REGISTRIES"
+
+// hostsDirEnv is the directory of containerd-style hosts.toml registry
+// configurations, used to query mirrors before the upstream registries
+const hostsDirEnv = "MQUERY_HOSTS_DIR"
+
+// Config holds the registry access settings of the service
+type Config struct {
+	// InsecureRegistries lists the registry hosts (with an optional port)
+	// whose TLS certificates aren't verified and which may be accessed over
+	// plain HTTP
+	InsecureRegistries []string
+	// HostsDir is the directory of registry host configurations listing the
+	// mirrors of each registry
+	HostsDir string
+}
+
+// ConfigFromEnv returns the service configuration from the environment
+func ConfigFromEnv() Config {
+	cfg := Config{HostsDir: os.Getenv(hostsDirEnv)}
+	for _, host := range strings.Split(os.Getenv(insecureRegistriesEnv), ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			cfg.InsecureRegistries = append(cfg.InsecureRegistries, host)
+		}
+	}
+	return cfg
+}
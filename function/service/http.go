@@ -0,0 +1,40 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// maxBodySize limits the size of a batch request body read by the HTTP server
+const maxBodySize = 1 << 20
+
+// ServeHTTP implements http.Handler so the service can be run as a plain
+// HTTP server
+func (s *Service) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := Request{
+		Method: r.Method,
+		Query:  r.URL.Query(),
+		Header: r.Header,
+	}
+	if r.Method == http.MethodPost {
+		body, err := readBody(w, r)
+		if err != nil {
+			writeJSON(w, BadRequest("Unable to read request body"))
+			return
+		}
+		req.Body = body
+	}
+	writeJSON(w, s.Handle(r.Context(), req))
+}
+
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	return io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+}
+
+func writeJSON(w http.ResponseWriter, resp Response) {
+	body, _ := json.Marshal(resp.Body)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.Status)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,333 @@
+// Package service implements the mquery backend API independently of the
+// transport (AWS Lambda or a plain HTTP server) that delivers requests to it
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/estesp/mquery/function/cache"
+	"github.com/estesp/mquery/pkg/inspect"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// RegistryTokenHeader optionally carries a short-lived bearer token used to
+	// query private images; it is only used for the single request
+	RegistryTokenHeader = "X-Registry-Token"
+	// RegistryHostHeader names the registry the token belongs to; without it,
+	// the token is only sent if all the requested images are on one registry
+	RegistryHostHeader = "X-Registry-Host"
+	// maxBatchSize limits the number of images accepted in one batch request
+	maxBatchSize = 100
+	// batchWorkers bounds the concurrent registry lookups for a batch request
+	batchWorkers = 8
+)
+
+// tracer records the spans of request handling and cache access
+var tracer = otel.Tracer("github.com/estesp/mquery/function/service")
+
+// error codes for invalid requests, in addition to the inspect.ErrorCode
+// values for registry query failures
+const (
+	CodeBadRequest       inspect.ErrorCode = "BAD_REQUEST"
+	CodeMethodNotAllowed inspect.ErrorCode = "METHOD_NOT_ALLOWED"
+)
+
+// ErrorBody is used to encapsulate error responses to the client. Code is a
+// stable identifier for the kind of error that clients can act on.
+type ErrorBody struct {
+	ErrorMsg string            `json:"error,omitempty"`
+	Code     inspect.ErrorCode `json:"code,omitempty"`
+	// RateLimit is the registry's rate limit status, if it reported one
+	RateLimit *inspect.RateLimit `json:"ratelimit,omitempty"`
+}
+
+// Request is an API request as received by any transport
+type Request struct {
+	Method string
+	Query  url.Values
+	Header http.Header
+	Body   []byte
+}
+
+// Response holds the status code and the body to be encoded as JSON
+type Response struct {
+	Status int
+	Body   interface{}
+}
+
+// Service answers image queries, caching registry results
+type Service struct {
+	cache cache.Cache
+	cfg   Config
+}
+
+// New creates a service using the given cache and configuration
+func New(c cache.Cache, cfg Config) *Service {
+	return &Service{cache: c, cfg: cfg}
+}
+
+// Handle dispatches a request to the single-image or batch query handler
+func (s *Service) Handle(ctx context.Context, req Request) (resp Response) {
+	ctx, span := tracer.Start(ctx, "service.Handle", trace.WithAttributes(attribute.String("http.request.method", req.Method)))
+	defer func() {
+		span.SetAttributes(attribute.Int("http.response.status_code", resp.Status))
+		if body, ok := resp.Body.(ErrorBody); ok {
+			span.SetStatus(codes.Error, body.ErrorMsg)
+		}
+		span.End()
+	}()
+	timeout, err := requestTimeout(req)
+	if err != nil {
+		return BadRequest(err.Error())
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	switch req.Method {
+	case http.MethodGet:
+		if req.Query.Get("repository") != "" {
+			return s.listTags(ctx, req)
+		}
+		return s.inspectImage(ctx, req)
+	case http.MethodPost:
+		return s.inspectBatch(ctx, req)
+	}
+	return Response{http.StatusMethodNotAllowed, ErrorBody{ErrorMsg: "method not allowed", Code: CodeMethodNotAllowed}}
+}
+
+// BadRequest returns the response for an invalid request
+func BadRequest(msg string) Response {
+	return Response{http.StatusBadRequest, ErrorBody{ErrorMsg: msg, Code: CodeBadRequest}}
+}
+
+// errorResponse maps a failed registry query to an HTTP status and error
+// code; prefix describes the query that failed
+func errorResponse(prefix string, err error) Response {
+	code := inspect.Code(err)
+	return Response{errorStatus(code), ErrorBody{ErrorMsg: fmt.Sprintf("%s: %s", prefix, err), Code: code, RateLimit: inspect.RateLimitOf(err)}}
+}
+
+func errorStatus(code inspect.ErrorCode) int {
+	switch code {
+	case inspect.CodeInvalidName:
+		return http.StatusBadRequest
+	case inspect.CodeNotFound:
+		return http.StatusNotFound
+	case inspect.CodeUnauthorized:
+		return http.StatusUnauthorized
+	case inspect.CodeDenied:
+		return http.StatusForbidden
+	case inspect.CodeRateLimited:
+		return http.StatusTooManyRequests
+	case inspect.CodeUnavailable:
+		return http.StatusBadGateway
+	case inspect.CodeTimeout:
+		return http.StatusGatewayTimeout
+	case inspect.CodeUnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusInternalServerError
+}
+
+func (s *Service) inspectImage(ctx context.Context, req Request) Response {
+	imageName := req.Query.Get("image")
+	if len(imageName) == 0 {
+		return BadRequest("No image name provided")
+	}
+	policy, err := cachePolicy(req)
+	if err != nil {
+		return BadRequest(err.Error())
+	}
+	image, err := s.lookupImage(ctx, imageName, s.queryOptions(req, imageName), policy)
+	if err != nil {
+		return errorResponse("Error querying image", err)
+	}
+	return Response{http.StatusOK, image}
+}
+
+// listTags returns the tags of a repository; tag lists are not cached
+func (s *Service) listTags(ctx context.Context, req Request) Response {
+	repository := req.Query.Get("repository")
+	tags, err := inspect.ListTags(ctx, repository, s.queryOptions(req, repository))
+	if err != nil {
+		return errorResponse("Error listing tags", err)
+	}
+	return Response{http.StatusOK, tags}
+}
+
+// inspectBatch handles a POST of a JSON array of image names, querying them
+// concurrently and returning a result or error for each image in order
+func (s *Service) inspectBatch(ctx context.Context, req Request) Response {
+	var names []string
+	if err := json.Unmarshal(req.Body, &names); err != nil {
+		return BadRequest("Request body must be a JSON array of image names")
+	}
+	if len(names) == 0 {
+		return BadRequest("No image names provided")
+	}
+	if len(names) > maxBatchSize {
+		return BadRequest(fmt.Sprintf("Too many images in batch request (maximum %d)", maxBatchSize))
+	}
+	policy, err := cachePolicy(req)
+	if err != nil {
+		return BadRequest(err.Error())
+	}
+	opts := s.queryOptions(req, names...)
+	results := inspect.Batch(names, batchWorkers, func(name string) (*inspect.Image, error) {
+		return s.lookupImage(ctx, name, opts, policy)
+	})
+	return Response{http.StatusOK, results}
+}
+
+// queryOptions returns the registry query options requested by the client
+// for the named images and the configured registry access settings
+func (s *Service) queryOptions(req Request, names ...string) inspect.Options {
+	deep, _ := strconv.ParseBool(req.Query.Get("deep"))
+	registry := req.Header.Get(RegistryHostHeader)
+	if registry == "" {
+		registry = inspect.CommonRegistry(names)
+	}
+	// the service's own registry credentials must never be used on behalf of
+	// a caller, and the results are shared through the cache
+	return inspect.Options{
+		Token:              req.Header.Get(RegistryTokenHeader),
+		Registry:           registry,
+		IgnoreDockerConfig: true,
+		Deep:               deep,
+		InsecureRegistries: s.cfg.InsecureRegistries,
+		HostsDir:           s.cfg.HostsDir,
+	}
+}
+
+// requestTimeout parses the optional timeout query parameter, the number of
+// seconds the registry queries for the request may take; zero is no limit
+// beyond the transport's own
+func requestTimeout(req Request) (time.Duration, error) {
+	v := req.Query.Get("timeout")
+	if v == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid timeout value %q: must be a number of seconds", v)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// freshness is the client's cache policy for a query
+type freshness struct {
+	// noCache skips the cache and always re-inspects the image
+	noCache bool
+	// maxAge is how long a cached result may be served without checking the
+	// registry for a new digest; zero always revalidates
+	maxAge time.Duration
+}
+
+// cachePolicy parses the optional no-cache and max-age (in seconds) query
+// parameters
+func cachePolicy(req Request) (freshness, error) {
+	var policy freshness
+	if v := req.Query.Get("no-cache"); v != "" {
+		noCache, err := strconv.ParseBool(v)
+		if err != nil {
+			return policy, fmt.Errorf("Invalid no-cache value %q", v)
+		}
+		policy.noCache = noCache
+	}
+	if v := req.Query.Get("max-age"); v != "" {
+		seconds, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return policy, fmt.Errorf("Invalid max-age value %q: must be a number of seconds", v)
+		}
+		policy.maxAge = time.Duration(seconds) * time.Second
+	}
+	return policy, nil
+}
+
+// lookupImage returns the image details from the cache if they are still
+// current, otherwise queries the registry and caches the result. Images are
+// cached under their canonical name, so equivalent names share an entry.
+func (s *Service) lookupImage(ctx context.Context, imageName string, opts inspect.Options, policy freshness) (*inspect.Image, error) {
+	canonical, pinned, err := inspect.CanonicalName(imageName)
+	if err != nil {
+		return nil, err
+	}
+	// authenticated queries for private images must neither be served from
+	// nor stored in the shared cache
+	cacheable := opts.Token == ""
+	if cacheable && !policy.noCache {
+		// a cached shallow result can't satisfy a deep query
+		if image, err := s.checkCache(ctx, canonical, pinned, opts, policy.maxAge); err == nil && (!opts.Deep || image.HasDetails()) {
+			return image, nil
+		}
+	}
+	image, err := inspect.QueryRegistry(ctx, canonical, opts)
+	if err != nil {
+		return nil, err
+	}
+	if cacheable {
+		if err = s.cacheImage(ctx, image); err != nil {
+			log.Printf("WARN: unable to cache image: %v", err)
+		}
+	}
+	return image, nil
+}
+
+// checkCache returns the cached image if it is younger than maxAge or if the
+// registry still resolves the name to the cached digest. A revalidated entry
+// is stored again with a new timestamp. Digest-pinned references are
+// immutable, so they are never revalidated. If the registry is rate limiting
+// or unavailable, the stale entry is served, keeping its old timestamp.
+func (s *Service) checkCache(ctx context.Context, imageName string, pinned bool, opts inspect.Options, maxAge time.Duration) (image *inspect.Image, err error) {
+	ctx, span := tracer.Start(ctx, "service.checkCache", trace.WithAttributes(attribute.String("mquery.image", imageName)))
+	defer func() {
+		span.SetAttributes(attribute.Bool("mquery.cache.hit", err == nil))
+		span.End()
+	}()
+	item, err := s.cache.Get(imageName)
+	if err != nil {
+		return nil, err
+	}
+	if pinned || time.Since(time.Unix(item.CacheTS, 0)) <= maxAge {
+		return item, nil
+	}
+	digest, err := inspect.ResolveDigest(ctx, imageName, opts)
+	if err != nil {
+		if code := inspect.Code(err); code == inspect.CodeRateLimited || code == inspect.CodeUnavailable {
+			log.Printf("WARN: serving stale cached image %s: %v", imageName, err)
+			span.SetAttributes(attribute.Bool("mquery.cache.stale", true))
+			return item, nil
+		}
+		return nil, err
+	}
+	if digest != item.Digest {
+		return nil, fmt.Errorf("cached image %s is stale: digest changed to %s", imageName, digest)
+	}
+	item.CacheTS = time.Now().Unix()
+	if err := s.cacheImage(ctx, item); err != nil {
+		log.Printf("WARN: unable to refresh cached image: %v", err)
+	}
+	return item, nil
+}
+
+func (s *Service) cacheImage(ctx context.Context, image *inspect.Image) error {
+	_, span := tracer.Start(ctx, "service.cacheImage", trace.WithAttributes(attribute.String("mquery.image", image.ImageName)))
+	defer span.End()
+	// the rate limit status only applies to the query that fetched the image
+	cached := *image
+	cached.RateLimit = nil
+	return s.cache.Put(image.ImageName, &cached)
+}
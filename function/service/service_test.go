@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/estesp/mquery/function/cache"
+	"github.com/estesp/mquery/pkg/inspect"
+)
+
+const (
+	cachedDigest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	newDigest    = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+// testRegistry answers manifest HEAD requests with the given digest, or with
+// the status if it isn't 200, and counts the manifest requests
+func testRegistry(t *testing.T, status int, digest string) (string, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.URL.Path, "/manifests/") {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		requests.Add(1)
+		if status != http.StatusOK {
+			// retry immediately to keep the test fast
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.oci.image.index.v1+json")
+		w.Header().Set("Docker-Content-Digest", digest)
+		w.Header().Set("Content-Length", "100")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://"), &requests
+}
+
+func TestCheckCache(t *testing.T) {
+	tests := []struct {
+		name   string
+		pinned bool
+		age    time.Duration
+		maxAge time.Duration
+		status int
+		digest string
+		// wantHit is whether the cached image is returned, and wantQuery
+		// whether the registry was asked for the current digest
+		wantHit   bool
+		wantQuery bool
+		// wantRefresh is whether the entry is stored with a new timestamp
+		wantRefresh bool
+	}{
+		{name: "pinned", pinned: true, age: time.Hour, status: http.StatusInternalServerError, wantHit: true},
+		{name: "within max-age", age: time.Minute, maxAge: time.Hour, status: http.StatusInternalServerError, wantHit: true},
+		{name: "same digest", age: time.Hour, status: http.StatusOK, digest: cachedDigest, wantHit: true, wantQuery: true, wantRefresh: true},
+		{name: "older than max-age", age: time.Hour, maxAge: time.Minute, status: http.StatusOK, digest: cachedDigest, wantHit: true, wantQuery: true, wantRefresh: true},
+		{name: "digest changed", age: time.Hour, status: http.StatusOK, digest: newDigest, wantQuery: true},
+		{name: "not found", age: time.Hour, status: http.StatusNotFound, wantQuery: true},
+		{name: "rate limited", age: time.Hour, status: http.StatusTooManyRequests, wantHit: true, wantQuery: true},
+		{name: "unavailable", age: time.Hour, status: http.StatusServiceUnavailable, wantHit: true, wantQuery: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, requests := testRegistry(t, tt.status, tt.digest)
+			imageName := host + "/app:latest"
+			cachedTS := time.Now().Add(-tt.age).Unix()
+			s := New(cache.NewMemory(0), Config{})
+			if err := s.cache.Put(imageName, &inspect.Image{ImageName: imageName, Digest: cachedDigest, CacheTS: cachedTS}); err != nil {
+				t.Fatal(err)
+			}
+			opts := inspect.Options{PlainHTTP: true, IgnoreDockerConfig: true}
+
+			image, err := s.checkCache(context.Background(), imageName, tt.pinned, opts, tt.maxAge)
+			if tt.wantHit {
+				if err != nil {
+					t.Fatalf("checkCache: %v", err)
+				}
+				if image.Digest != cachedDigest {
+					t.Errorf("checkCache returned digest %s, want %s", image.Digest, cachedDigest)
+				}
+			} else if err == nil {
+				t.Fatalf("checkCache returned the cached image, want a miss")
+			}
+			if queried := requests.Load() > 0; queried != tt.wantQuery {
+				t.Errorf("registry queried = %v, want %v", queried, tt.wantQuery)
+			}
+			stored, err := s.cache.Get(imageName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if refreshed := stored.CacheTS != cachedTS; refreshed != tt.wantRefresh {
+				t.Errorf("cache entry refreshed = %v, want %v", refreshed, tt.wantRefresh)
+			}
+		})
+	}
+}
+
+func TestCheckCacheMiss(t *testing.T) {
+	s := New(cache.NewMemory(0), Config{})
+	if _, err := s.checkCache(context.Background(), "registry.example.com/app:latest", false, inspect.Options{}, time.Hour); err != cache.ErrNotFound {
+		t.Errorf("checkCache of an empty cache = %v, want %v", err, cache.ErrNotFound)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		code inspect.ErrorCode
+		want int
+	}{
+		{inspect.CodeInvalidName, http.StatusBadRequest},
+		{inspect.CodeNotFound, http.StatusNotFound},
+		{inspect.CodeUnauthorized, http.StatusUnauthorized},
+		{inspect.CodeDenied, http.StatusForbidden},
+		{inspect.CodeRateLimited, http.StatusTooManyRequests},
+		{inspect.CodeUnavailable, http.StatusBadGateway},
+		{inspect.CodeTimeout, http.StatusGatewayTimeout},
+		{inspect.CodeUnsupportedMediaType, http.StatusUnsupportedMediaType},
+		{inspect.CodeInternal, http.StatusInternalServerError},
+		{"UNKNOWN", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := errorStatus(tt.code); got != tt.want {
+			t.Errorf("errorStatus(%s) = %d, want %d", tt.code, got, tt.want)
+		}
+	}
+}
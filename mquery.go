@@ -1,62 +1,318 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/containerd/log"
 	"github.com/dghubble/sling"
+	"github.com/estesp/mquery/pkg/inspect"
 	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
+// registryTokenHeader carries a registry bearer token to the backend so it can
+// inspect private images without storing any credentials itself;
+// registryHostHeader names the registry the token belongs to
+const (
+	registryTokenHeader = "X-Registry-Token"
+	registryHostHeader  = "X-Registry-Host"
+)
+
+// exit codes returned by mquery
+const (
+	exitOK = 0
+	// exitError is returned when an image cannot be queried
+	exitError = 1
+	// exitUsage is returned for invalid flags, as by the flag package
+	exitUsage = 2
+	// exitMissingPlatforms is returned when an image lacks a --require platform
+	exitMissingPlatforms = 3
+	// exitNotFound is returned when the image doesn't exist
+	exitNotFound = 4
+	// exitUnauthorized is returned when access to the image is denied
+	exitUnauthorized = 5
+	// exitRegistryError is returned when the registry is unavailable or rate
+	// limited
+	exitRegistryError = 6
+	// exitUnsupported is returned for manifests mquery can't interpret
+	exitUnsupported = 7
+	// exitDifferences is returned by diff when the images differ
+	exitDifferences = 8
+	// exitTimeout is returned when the query doesn't complete within --timeout
+	exitTimeout = 9
+)
+
+// backendTimeoutMargin is added to --timeout for requests to the backend, so
+// the backend can report its own timeout before the client gives up
+const backendTimeoutMargin = 5 * time.Second
+
+// baseURL is the public mquery backend used unless another endpoint is configured
 const baseURL = "https://2xopp470jc.execute-api.us-east-2.amazonaws.com/mquery"
 
-// QueryParams defines the parameters sent; in our case only "image" is needed
+// QueryParams defines the parameters sent to the backend
 type QueryParams struct {
-	Image string `url:"image"`
+	Image      string `url:"image,omitempty"`
+	Repository string `url:"repository,omitempty"`
+	Deep       bool   `url:"deep,omitempty"`
+	NoCache    bool   `url:"no-cache,omitempty"`
+	MaxAge     int64  `url:"max-age,omitempty"`
+	Timeout    int64  `url:"timeout,omitempty"`
 }
 
 // ErrorResponse holds the payload response on failure HTTP codes
 type ErrorResponse struct {
-	Error string `json:"error,omitempty"`
+	Error     string             `json:"error,omitempty"`
+	Code      inspect.ErrorCode  `json:"code,omitempty"`
+	RateLimit *inspect.RateLimit `json:"ratelimit,omitempty"`
 }
 
 // Image contains the JSON struct we get from success
-type Image struct {
-	CacheTS   int64              `json:"cachets"`
-	IsList    bool               `json:"islist"`
-	ImageName string             `json:"imagename"`
-	Digest    string             `json:"digest"`
-	MediaType string             `json:"mediatype"`
-	ArchList  []ocispec.Platform `json:"archlist"`
-}
+type Image = inspect.Image
+
+var (
+	direct     = flag.Bool("direct", false, "query the image registry directly instead of the mquery backend")
+	endpoint   = flag.String("endpoint", "", "mquery backend endpoint URL (default $"+endpointEnv+", config file, or the public endpoint)")
+	configPath = flag.String("config", defaultConfigPath(), "path to the mquery config file")
+	headers    = headerFlags{}
+
+	showDigests      = flag.Bool("digests", false, "show the manifest digest and size for each platform")
+	deep             = flag.Bool("deep", false, "include the created time, layer count and size, and config of each platform's image")
+	showAttestations = flag.Bool("attestations", false, "show attestation manifests (provenance, SBOM) and the platforms they refer to")
+	verbose          = flag.Bool("verbose", false, "show the registry endpoint that served the image, and print the registry rate limit status (reported by Docker Hub) to stderr")
+
+	username      = flag.String("username", "", "registry username for direct queries")
+	password      = flag.String("password", "", "registry password for direct queries")
+	dockerConfig  = flag.String("docker-config", "", "directory of the Docker config.json used for registry credentials (default $DOCKER_CONFIG or ~/.docker)")
+	registryToken = flag.String("registry-token", "", "short-lived registry bearer token, passed to the backend or used directly with --direct")
+	registryHost  = flag.String("registry", "", "registry the --registry-token, --username and --password belong to (default the registry of the named images)")
+	insecure      = flag.Bool("insecure", false, "skip TLS certificate verification, falling back to plain HTTP, for direct queries")
+	plainHTTP     = flag.Bool("plain-http", false, "use plain HTTP instead of HTTPS for direct queries")
+	hostsDir      = flag.String("hosts-dir", "", "directory of containerd-style registry hosts.toml files configuring mirrors for direct queries")
+
+	noCache = flag.Bool("no-cache", false, "ask the backend to ignore cached results and query the registry")
+	maxAge  = flag.Duration("max-age", 0, "accept a backend cached result this old without checking the registry for a new digest")
+	timeout = flag.Duration("timeout", 0, "abandon registry queries that take longer than this (default no limit)")
+)
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Printf("ERROR: Must provide an image name as a command line parameter.\n")
-		os.Exit(1)
+	flag.Var(headers, "header", "custom 'Name: value' header to send to the backend (may be repeated)")
+	flag.Var(&required, "require", "comma-separated platforms (e.g. linux/amd64,linux/arm64/v8,windows/amd64) the image must support; exits with code 3 if any are missing")
+	parseFlags(os.Args[1:])
+	// containerd logs each registry host it falls back from at info level;
+	// the CLI reports failures itself; "warn" is always a valid level
+	_ = log.SetLevel("warn")
+	if err := startTracing(); err != nil {
+		printError("invalid tracing configuration: %v\n", err)
+		os.Exit(exitError)
 	}
-	qparam := &QueryParams{
-		Image: os.Args[1],
+	switch flag.Arg(0) {
+	case "diff":
+		exit(diffCommand(flag.Args()[1:]))
+	case "tags":
+		exit(tagsCommand(flag.Args()[1:]))
+	case "watch":
+		exit(watchCommand(flag.Args()[1:]))
 	}
+	images, err := imageNames()
+	if err != nil {
+		printError("%v\n", err)
+		exit(exitError)
+	}
+	if len(images) < 1 {
+		printError("Must provide an image name as a command line parameter.\n")
+		exit(exitError)
+	}
+	if err := validateOutput(); err != nil {
+		printError("%v\n", err)
+		exit(exitError)
+	}
+	if *direct {
+		if len(images) > 1 {
+			exit(queryDirectBatch(images))
+		}
+		exit(queryDirect(images[0]))
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		printError("failed to load config: %v\n", err)
+		exit(exitError)
+	}
+	client := newBackendClient(resolveEndpoint(*endpoint, cfg), cfg, images)
+	if len(images) > 1 {
+		exit(queryBackendBatch(client, images))
+	}
+	imageName := images[0]
 	image := new(Image)
 	errResp := new(ErrorResponse)
-	resp, err := sling.New().Base(baseURL).QueryStruct(qparam).Receive(image, errResp)
+	resp, err := client.QueryStruct(queryParams(imageName)).Receive(image, errResp)
+	if err != nil {
+		exit(backendError(err))
+	}
+	exit(processResponse(resp, imageName, errResp, image))
+}
+
+// parseFlags parses the command line like flag.Parse, but also accepts flags
+// after the image names and subcommand arguments, as in "mquery alpine
+// --direct"; an argument of "--" ends the flags. Afterwards flag.Args()
+// returns just the positional arguments.
+func parseFlags(args []string) {
+	var positional []string
+	for {
+		if err := flag.CommandLine.Parse(args); err != nil {
+			os.Exit(exitUsage)
+		}
+		rest := flag.Args()
+		if len(rest) == 0 {
+			break
+		}
+		if len(rest) < len(args) && args[len(args)-len(rest)-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+	// after "--", the remaining arguments are never parsed as flags
+	if err := flag.CommandLine.Parse(append([]string{"--"}, positional...)); err != nil {
+		os.Exit(exitUsage)
+	}
+}
+
+// parseSubcommand checks that a subcommand was given nargs arguments,
+// returning an error showing its usage if not. Flags given after the
+// subcommand were already parsed by parseFlags.
+func parseSubcommand(args []string, usage string, nargs int) error {
+	if len(args) != nargs {
+		return fmt.Errorf("Usage: mquery [flags] %s", usage)
+	}
+	return nil
+}
+
+// queryParams returns the backend query parameters for the image; an empty
+// name is used for batch requests, where the images are sent in the body
+func queryParams(imageName string) *QueryParams {
+	return &QueryParams{
+		Image:   imageName,
+		Deep:    *deep,
+		NoCache: *noCache,
+		MaxAge:  int64(maxAge.Seconds()),
+		Timeout: timeoutSeconds(),
+	}
+}
+
+// timeoutSeconds returns --timeout in whole seconds for the backend, rounding
+// up so a short timeout isn't sent as no limit
+func timeoutSeconds() int64 {
+	return int64((*timeout + time.Second - 1) / time.Second)
+}
+
+// queryContext returns the context for a query, cancelled after --timeout
+func queryContext() (context.Context, context.CancelFunc) {
+	if *timeout <= 0 {
+		return context.WithCancel(rootContext)
+	}
+	return context.WithTimeout(rootContext, *timeout)
+}
+
+// newBackendClient returns a sling client for the backend endpoint with any
+// configured headers applied; headers given on the command line take
+// precedence over those in the config file
+func newBackendClient(endpoint string, cfg *Config, names []string) *sling.Sling {
+	httpClient := &http.Client{}
+	if *timeout > 0 {
+		httpClient.Timeout = *timeout + backendTimeoutMargin
+	}
+	client := sling.New().Base(endpoint).Doer(newTracingDoer(httpClient))
+	for name, value := range cfg.Headers {
+		client.Set(name, value)
+	}
+	for name, value := range headers {
+		client.Set(name, value)
+	}
+	if *registryToken != "" {
+		client.Set(registryTokenHeader, *registryToken)
+		client.Set(registryHostHeader, credentialsRegistry(names))
+	}
+	return client
+}
+
+// queryDirect inspects the image by talking to its registry from this
+// process, bypassing the mquery backend entirely
+func queryDirect(imageName string) int {
+	ctx, cancel := queryContext()
+	defer cancel()
+	image, err := inspect.QueryRegistry(ctx, imageName, directOptions(imageName))
 	if err != nil {
-		fmt.Printf("ERROR: failed to query backend: %v\n", err)
-		os.Exit(1)
+		printRateLimit(inspect.RateLimitOf(err))
+		return reportError(imageName, inspect.Code(err), fmt.Sprintf("failed to query registry: %v", err))
 	}
-	os.Exit(processResponse(resp, os.Args[1], errResp, image))
+	printRateLimit(image.RateLimit)
+	return outputImage(imageName, image)
+}
+
+// directOptions returns the registry access options for direct queries of
+// the named images
+func directOptions(names ...string) inspect.Options {
+	return inspect.Options{
+		Username:     *username,
+		Password:     *password,
+		DockerConfig: *dockerConfig,
+		Token:        *registryToken,
+		Registry:     credentialsRegistry(names),
+		Deep:         *deep,
+		Insecure:     *insecure,
+		PlainHTTP:    *plainHTTP,
+		HostsDir:     *hostsDir,
+		// a local registry is often run without TLS
+		LocalPlainHTTP: true,
+	}
+}
+
+// credentialsRegistry returns the registry that the credentials given on the
+// command line are sent to: --registry, or else the registry of the named
+// images. Credentials are never sent to any other registry, so they go
+// nowhere if the images are on different registries.
+func credentialsRegistry(names []string) string {
+	if *registryHost != "" {
+		return *registryHost
+	}
+	registry := inspect.CommonRegistry(names)
+	if registry == "" && (*registryToken != "" || *username != "" || *password != "") {
+		fmt.Fprintln(os.Stderr, "WARNING: the images are on different registries; use --registry to choose which one the credentials are sent to")
+	}
+	return registry
 }
 
 func processResponse(resp *http.Response, imageName string, errResp *ErrorResponse, image *Image) int {
 	if resp.StatusCode != 200 {
-		// non-success RC from our http request
-		fmt.Printf("ERROR: %s\n", errResp.Error)
-		return 1
+		// non-success RC from our http request; older backends don't return
+		// an error code, so fall back to the status code
+		code := errResp.Code
+		if code == "" {
+			code = statusCode(resp.StatusCode)
+		}
+		printRateLimit(errResp.RateLimit)
+		return reportError(imageName, code, errResp.Error)
+	}
+	printRateLimit(image.RateLimit)
+	return outputImage(imageName, image)
+}
+
+func outputImage(imageName string, image *Image) int {
+	if err := printImage(imageName, image); err != nil {
+		printError("failed to print image information: %v\n", err)
+		return exitError
+	}
+	if !checkRequired(imageName, image) {
+		return exitMissingPlatforms
 	}
-	printManifestInfo(imageName, image)
-	return 0
+	return exitOK
 }
 
 func printManifestInfo(imageName string, image *Image) {
@@ -66,18 +322,101 @@ func printManifestInfo(imageName string, image *Image) {
 		list = "No"
 	}
 	fmt.Printf(" * Manifest List: %s (Image type: %s)\n", list, image.MediaType)
+	if *verbose && image.Endpoint != "" {
+		fmt.Printf(" * Served by: %s\n", image.Endpoint)
+	}
 	if image.IsList {
 		fmt.Println(" * Supported platforms:")
-		for _, platform := range image.ArchList {
+		for i, platform := range image.ArchList {
 			platformOutput := parsePlatform(platform)
+			if *showDigests && i < len(image.Manifests) {
+				platformOutput = fmt.Sprintf("%s (digest: %s, size: %d)", platformOutput, image.Manifests[i].Digest, image.Manifests[i].Size)
+				if path := image.Manifests[i].IndexPath; len(path) > 0 {
+					platformOutput = fmt.Sprintf("%s (via index: %s)", platformOutput, strings.Join(path, " > "))
+				}
+			}
 			fmt.Printf("   - %s\n", platformOutput)
+			if i < len(image.Manifests) && image.Manifests[i].Details != nil {
+				printDetails("     ", image.Manifests[i].Details)
+			}
 		}
 	} else {
-		fmt.Printf(" * Supports: %s\n", parsePlatform(image.ArchList[0]))
+		if image.ArtifactType != "" {
+			fmt.Printf(" * Artifact type: %s\n", image.ArtifactType)
+		}
+		if len(image.ArchList) > 0 {
+			fmt.Printf(" * Supports: %s\n", parsePlatform(image.ArchList[0]))
+		}
+		if len(image.Manifests) > 0 && image.Manifests[0].Details != nil {
+			printDetails("   ", image.Manifests[0].Details)
+		}
+	}
+	if *showAttestations && image.IsList {
+		printAttestations(image)
 	}
 	fmt.Println("")
 }
 
+func printDetails(indent string, details *inspect.Details) {
+	created := "unknown"
+	if details.Created != nil {
+		created = details.Created.Format(time.RFC3339)
+	}
+	fmt.Printf("%sCreated: %s, Layers: %d, Size: %s\n", indent, created, details.Layers, formatSize(details.Size))
+	if len(details.Entrypoint) > 0 {
+		fmt.Printf("%sEntrypoint: %s\n", indent, strings.Join(details.Entrypoint, " "))
+	}
+	if len(details.Cmd) > 0 {
+		fmt.Printf("%sCmd: %s\n", indent, strings.Join(details.Cmd, " "))
+	}
+	if details.User != "" {
+		fmt.Printf("%sUser: %s\n", indent, details.User)
+	}
+	for _, env := range details.Env {
+		fmt.Printf("%sEnv: %s\n", indent, env)
+	}
+	labels := make([]string, 0, len(details.Labels))
+	for k := range details.Labels {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+	for _, k := range labels {
+		fmt.Printf("%sLabel: %s=%s\n", indent, k, details.Labels[k])
+	}
+}
+
+// formatSize returns a human-readable size using binary units
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func printAttestations(image *Image) {
+	if len(image.Attestations) == 0 {
+		fmt.Println(" * Attestations: None")
+		return
+	}
+	fmt.Println(" * Attestations:")
+	for _, att := range image.Attestations {
+		target := att.Reference
+		if att.Platform != nil {
+			target = parsePlatform(*att.Platform)
+		}
+		fmt.Printf("   - %s: %s (%s)\n", target, att.Digest, att.Type)
+		for _, pt := range att.PredicateTypes {
+			fmt.Printf("     - %s\n", pt)
+		}
+	}
+}
+
 func parsePlatform(platform ocispec.Platform) string {
 	platformStr := fmt.Sprintf("%s/%s", platform.OS, platform.Architecture)
 	if len(platform.Variant) > 0 {
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+func TestParseFlags(t *testing.T) {
+	defer func() { *direct, *deep = false, false }()
+	tests := []struct {
+		args   []string
+		want   []string
+		direct bool
+	}{
+		{[]string{"alpine"}, []string{"alpine"}, false},
+		{[]string{"--direct", "alpine"}, []string{"alpine"}, true},
+		{[]string{"alpine", "--direct"}, []string{"alpine"}, true},
+		{[]string{"diff", "alpine", "--direct", "busybox", "--deep"}, []string{"diff", "alpine", "busybox"}, true},
+		{[]string{"alpine", "--", "--direct"}, []string{"alpine", "--direct"}, false},
+	}
+	for _, tt := range tests {
+		*direct = false
+		parseFlags(tt.args)
+		if got := flag.Args(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseFlags(%q) args = %q, want %q", tt.args, got, tt.want)
+		}
+		if *direct != tt.direct {
+			t.Errorf("parseFlags(%q) direct = %v, want %v", tt.args, *direct, tt.direct)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/estesp/mquery/pkg/inspect"
+	"sigs.k8s.io/yaml"
+)
+
+// supported values for the --output flag
+const (
+	outputText  = "text"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+	outputTable = "table"
+)
+
+var (
+	outputFormat = flag.String("output", outputText, "output format: text, json, yaml or table")
+	formatTmpl   = flag.String("format", "", "format the output using the given Go template (overrides --output)")
+)
+
+// templateFuncs are the helper functions available to --format templates
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"platform": parsePlatform,
+	"join":     strings.Join,
+}
+
+// validateOutput checks the output flags before any query is made so that a
+// typo doesn't cost a round-trip to the backend or registry
+func validateOutput() error {
+	if *formatTmpl != "" {
+		_, err := template.New("format").Funcs(templateFuncs).Parse(*formatTmpl)
+		return err
+	}
+	switch *outputFormat {
+	case outputText, outputJSON, outputYAML, outputTable:
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q", *outputFormat)
+}
+
+// structuredOutput reports whether the output is JSON, YAML or a --format
+// template, for other tools to parse
+func structuredOutput() bool {
+	return *formatTmpl != "" || *outputFormat == outputJSON || *outputFormat == outputYAML
+}
+
+// errorOutput returns where errors are printed: stderr for structured output,
+// which they would otherwise corrupt, or else stdout alongside the text
+func errorOutput() io.Writer {
+	if structuredOutput() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// render writes v to stdout using the --format template, or as JSON or YAML
+// if selected by --output. It reports whether v was rendered; for text and
+// table output, the caller prints v itself.
+func render(v interface{}) (bool, error) {
+	if *formatTmpl != "" {
+		tmpl, err := template.New("format").Funcs(templateFuncs).Parse(*formatTmpl)
+		if err != nil {
+			return true, err
+		}
+		if err := tmpl.Execute(os.Stdout, v); err != nil {
+			return true, err
+		}
+		fmt.Println()
+		return true, nil
+	}
+	switch *outputFormat {
+	case outputJSON:
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return true, err
+		}
+		fmt.Println(string(b))
+		return true, nil
+	case outputYAML:
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			return true, err
+		}
+		fmt.Print(string(b))
+		return true, nil
+	}
+	return false, nil
+}
+
+// printImage writes the image information to stdout in the selected format
+func printImage(imageName string, image *Image) error {
+	if rendered, err := render(image); rendered || err != nil {
+		return err
+	}
+	if *outputFormat == outputTable {
+		printTable(imageName, image)
+	} else {
+		printManifestInfo(imageName, image)
+	}
+	return nil
+}
+
+// printResults writes the results of a multi-image query to stdout in the
+// selected format; JSON and YAML output is a list of per-image results, and
+// a --format template is applied to each image
+func printResults(results []inspect.Result) error {
+	if *formatTmpl == "" {
+		if rendered, err := render(results); rendered || err != nil {
+			return err
+		}
+		if *outputFormat == outputTable {
+			w := newTableWriter()
+			for _, result := range results {
+				if result.Image != nil {
+					printTableRows(w, result.Name, result.Image)
+				}
+			}
+			w.Flush()
+			printResultErrors(results)
+			return nil
+		}
+	}
+	for _, result := range results {
+		if result.Image == nil {
+			continue
+		}
+		if err := printImage(result.Name, result.Image); err != nil {
+			return err
+		}
+	}
+	printResultErrors(results)
+	return nil
+}
+
+func printResultErrors(results []inspect.Result) {
+	for _, result := range results {
+		if result.Error != "" {
+			printError("%s: %s\n", result.Name, result.Error)
+		}
+	}
+}
+
+// printRateLimit prints the registry's rate limit status with --verbose; it
+// goes to stderr so it doesn't mix with the JSON or YAML output
+func printRateLimit(rl *inspect.RateLimit) {
+	if !*verbose || rl == nil {
+		return
+	}
+	window := ""
+	if rl.Window > 0 {
+		window = fmt.Sprintf(" per %s", time.Duration(rl.Window)*time.Second)
+	}
+	fmt.Fprintf(os.Stderr, "Registry rate limit: %d of %d requests remaining%s\n", rl.Remaining, rl.Limit, window)
+}
+
+// lowestRateLimit returns the rate limit status with the fewest remaining
+// requests reported for any of the results
+func lowestRateLimit(results []inspect.Result) *inspect.RateLimit {
+	var lowest *inspect.RateLimit
+	for _, result := range results {
+		rl := result.RateLimit
+		if result.Image != nil {
+			rl = result.Image.RateLimit
+		}
+		if rl != nil && (lowest == nil || rl.Remaining < lowest.Remaining) {
+			lowest = rl
+		}
+	}
+	return lowest
+}
+
+// printTable prints one row per platform with the full OCI platform fields
+func printTable(imageName string, image *Image) {
+	w := newTableWriter()
+	printTableRows(w, imageName, image)
+	w.Flush()
+}
+
+// newTableWriter returns a tabwriter with the table header already written
+func newTableWriter() *tabwriter.Writer {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "IMAGE\tDIGEST\tMEDIA TYPE\tOS\tARCHITECTURE\tVARIANT\tOS VERSION\tOS FEATURES\tMANIFEST DIGEST\tSIZE")
+	return w
+}
+
+func printTableRows(w io.Writer, imageName string, image *Image) {
+	if len(image.ArchList) == 0 {
+		// artifacts without a platform still get a row
+		fmt.Fprintf(w, "%s\t%s\t%s\t\t\t\t\t\t\t\n", imageName, image.Digest, image.MediaType)
+		return
+	}
+	for i, p := range image.ArchList {
+		var manifest inspect.PlatformManifest
+		if i < len(image.Manifests) {
+			manifest = image.Manifests[i]
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%d\n", imageName, image.Digest, image.MediaType,
+			p.OS, p.Architecture, p.Variant, p.OSVersion, strings.Join(p.OSFeatures, ","), manifest.Digest, manifest.Size)
+	}
+}
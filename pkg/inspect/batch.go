@@ -0,0 +1,50 @@
+package inspect
+
+import "sync"
+
+// Result is the outcome of querying a single image as part of a batch
+type Result struct {
+	Name  string `json:"name"`
+	Image *Image `json:"image,omitempty"`
+	Error string `json:"error,omitempty"`
+	// Code classifies the error (see ErrorCode)
+	Code ErrorCode `json:"code,omitempty"`
+	// RateLimit is the registry's rate limit status when the query failed;
+	// for a successful query it is reported in Image
+	RateLimit *RateLimit `json:"ratelimit,omitempty"`
+}
+
+// Batch runs query for each of the named images using at most workers
+// concurrent lookups. Results are returned in the same order as names.
+func Batch(names []string, workers int, query func(string) (*Image, error)) []Result {
+	if workers < 1 {
+		workers = 1
+	}
+	results := make([]Result, len(names))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers && i < len(names); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range indexes {
+				result := Result{Name: names[idx]}
+				image, err := query(names[idx])
+				if err != nil {
+					result.Error = err.Error()
+					result.Code = Code(err)
+					result.RateLimit = RateLimitOf(err)
+				} else {
+					result.Image = image
+				}
+				results[idx] = result
+			}
+		}()
+	}
+	for i := range names {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,85 @@
+package inspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Details holds the image config and layer information for one platform
+type Details struct {
+	Created *time.Time `json:"created,omitempty"`
+	// Size is the total compressed size of the layers
+	Size       int64             `json:"size"`
+	Layers     int               `json:"layers"`
+	Entrypoint []string          `json:"entrypoint,omitempty"`
+	Cmd        []string          `json:"cmd,omitempty"`
+	Env        []string          `json:"env,omitempty"`
+	Labels     map[string]string `json:"labels,omitempty"`
+	User       string            `json:"user,omitempty"`
+}
+
+// HasDetails reports whether the image includes the results of a deep query
+func (i *Image) HasDetails() bool {
+	for _, m := range i.Manifests {
+		if m.Details == nil {
+			return false
+		}
+	}
+	return len(i.Manifests) > 0
+}
+
+// addDetails reads each platform's manifest and config, which were already
+// retrieved into the memory store while fetching the image, and records the
+// details for that platform
+func addDetails(cs *store.MemoryStore, image *Image) error {
+	for i, m := range image.Manifests {
+		desc := ocispec.Descriptor{
+			MediaType: m.MediaType,
+			Digest:    digest.Digest(m.Digest),
+			Size:      m.Size,
+		}
+		details, err := manifestDetails(cs, desc)
+		if err != nil {
+			return err
+		}
+		image.Manifests[i].Details = details
+	}
+	return nil
+}
+
+func manifestDetails(cs *store.MemoryStore, desc ocispec.Descriptor) (*Details, error) {
+	_, mb, ok := cs.Get(desc)
+	if !ok {
+		return nil, fmt.Errorf("manifest %s not found", desc.Digest)
+	}
+	var man ocispec.Manifest
+	if err := json.Unmarshal(mb, &man); err != nil {
+		return nil, err
+	}
+	_, cb, ok := cs.Get(man.Config)
+	if !ok {
+		return nil, fmt.Errorf("config %s not found", man.Config.Digest)
+	}
+	var conf ocispec.Image
+	if err := json.Unmarshal(cb, &conf); err != nil {
+		return nil, err
+	}
+	details := &Details{
+		Created:    conf.Created,
+		Layers:     len(man.Layers),
+		Entrypoint: conf.Config.Entrypoint,
+		Cmd:        conf.Config.Cmd,
+		Env:        conf.Config.Env,
+		Labels:     conf.Config.Labels,
+		User:       conf.Config.User,
+	}
+	for _, layer := range man.Layers {
+		details.Size += layer.Size
+	}
+	return details, nil
+}
@@ -0,0 +1,88 @@
+package inspect
+
+import (
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Diff describes the differences in platform support between two images
+type Diff struct {
+	// Added lists the platforms supported only by the second image
+	Added []ocispec.Platform `json:"added,omitempty"`
+	// Removed lists the platforms supported only by the first image
+	Removed []ocispec.Platform `json:"removed,omitempty"`
+	// Common lists the platforms supported by both images
+	Common []CommonPlatform `json:"common,omitempty"`
+}
+
+// CommonPlatform gives the manifest digest serving a platform in each image
+type CommonPlatform struct {
+	Platform   ocispec.Platform `json:"platform"`
+	FromDigest string           `json:"fromdigest,omitempty"`
+	ToDigest   string           `json:"todigest,omitempty"`
+	// Changed is set if the platform is served by a different manifest
+	Changed bool `json:"changed"`
+}
+
+// Compare returns the platform differences from image from to image to.
+// Platforms are compared after normalization, as in MatchPlatform, with
+// Windows OS versions compared exactly.
+func Compare(from, to *Image) Diff {
+	var diff Diff
+	toDigests := platformDigests(to)
+	fromDigests := platformDigests(from)
+	for i, p := range from.ArchList {
+		toDigest, ok := toDigests[platformKey(p)]
+		if !ok {
+			diff.Removed = append(diff.Removed, p)
+			continue
+		}
+		common := CommonPlatform{Platform: p, ToDigest: toDigest}
+		if i < len(from.Manifests) {
+			common.FromDigest = from.Manifests[i].Digest
+		}
+		common.Changed = common.FromDigest != "" && common.ToDigest != "" && common.FromDigest != common.ToDigest
+		diff.Common = append(diff.Common, common)
+	}
+	for _, p := range to.ArchList {
+		if _, ok := fromDigests[platformKey(p)]; !ok {
+			diff.Added = append(diff.Added, p)
+		}
+	}
+	return diff
+}
+
+// Changed reports whether the images differ in supported platforms or in the
+// manifest of any common platform
+func (d Diff) Changed() bool {
+	if len(d.Added) > 0 || len(d.Removed) > 0 {
+		return true
+	}
+	for _, c := range d.Common {
+		if c.Changed {
+			return true
+		}
+	}
+	return false
+}
+
+// platformDigests maps each of the image's platforms to its manifest digest
+func platformDigests(image *Image) map[string]string {
+	digests := make(map[string]string, len(image.ArchList))
+	for i, p := range image.ArchList {
+		var digest string
+		if i < len(image.Manifests) {
+			digest = image.Manifests[i].Digest
+		}
+		digests[platformKey(p)] = digest
+	}
+	return digests
+}
+
+func platformKey(p ocispec.Platform) string {
+	key := platforms.Format(platforms.Normalize(p))
+	if p.OSVersion != "" {
+		key += ":" + p.OSVersion
+	}
+	return key
+}
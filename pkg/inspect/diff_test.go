@@ -0,0 +1,121 @@
+package inspect
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// diffImage returns an image with a platform for each "platform@digest"
+// entry; entries without a digest leave out the image's manifests, as from
+// an older backend
+func diffImage(t *testing.T, entries ...string) *Image {
+	t.Helper()
+	image := new(Image)
+	for _, entry := range entries {
+		specifier, digest, found := strings.Cut(entry, "@")
+		p, err := ParsePlatform(specifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		image.ArchList = append(image.ArchList, p)
+		if found {
+			image.Manifests = append(image.Manifests, PlatformManifest{Platform: p, Digest: digest})
+		}
+	}
+	return image
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to []string
+		// the platforms are given in platformKey form
+		wantAdded   []string
+		wantRemoved []string
+		wantCommon  []string
+		wantChanged []string
+	}{
+		{
+			name:       "identical",
+			from:       []string{"linux/amd64@sha256:a", "linux/arm64@sha256:b"},
+			to:         []string{"linux/amd64@sha256:a", "linux/arm64@sha256:b"},
+			wantCommon: []string{"linux/amd64", "linux/arm64"},
+		},
+		{
+			name:       "added platform",
+			from:       []string{"linux/amd64@sha256:a"},
+			to:         []string{"linux/amd64@sha256:a", "linux/s390x@sha256:c"},
+			wantAdded:  []string{"linux/s390x"},
+			wantCommon: []string{"linux/amd64"},
+		},
+		{
+			name:        "removed platform",
+			from:        []string{"linux/amd64@sha256:a", "linux/arm/v7@sha256:b"},
+			to:          []string{"linux/amd64@sha256:a"},
+			wantRemoved: []string{"linux/arm/v7"},
+			wantCommon:  []string{"linux/amd64"},
+		},
+		{
+			name:        "changed digest",
+			from:        []string{"linux/amd64@sha256:a", "linux/arm64@sha256:b"},
+			to:          []string{"linux/amd64@sha256:c", "linux/arm64@sha256:b"},
+			wantCommon:  []string{"linux/amd64", "linux/arm64"},
+			wantChanged: []string{"linux/amd64"},
+		},
+		{
+			name:       "normalized platforms",
+			from:       []string{"linux/arm64@sha256:a"},
+			to:         []string{"linux/arm64/v8@sha256:a"},
+			wantCommon: []string{"linux/arm64"},
+		},
+		{
+			name:        "windows os versions",
+			from:        []string{"windows/amd64:10.0.17763.2300@sha256:a"},
+			to:          []string{"windows/amd64:10.0.20348.169@sha256:a"},
+			wantAdded:   []string{"windows/amd64:10.0.20348.169"},
+			wantRemoved: []string{"windows/amd64:10.0.17763.2300"},
+		},
+		{
+			name:       "no manifest digests",
+			from:       []string{"linux/amd64"},
+			to:         []string{"linux/amd64@sha256:a"},
+			wantCommon: []string{"linux/amd64"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff := Compare(diffImage(t, tt.from...), diffImage(t, tt.to...))
+
+			var added, removed, common, changed []string
+			for _, p := range diff.Added {
+				added = append(added, platformKey(p))
+			}
+			for _, p := range diff.Removed {
+				removed = append(removed, platformKey(p))
+			}
+			for _, c := range diff.Common {
+				common = append(common, platformKey(c.Platform))
+				if c.Changed {
+					changed = append(changed, platformKey(c.Platform))
+				}
+			}
+			if !reflect.DeepEqual(added, tt.wantAdded) {
+				t.Errorf("Added = %q, want %q", added, tt.wantAdded)
+			}
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("Removed = %q, want %q", removed, tt.wantRemoved)
+			}
+			if !reflect.DeepEqual(common, tt.wantCommon) {
+				t.Errorf("Common = %q, want %q", common, tt.wantCommon)
+			}
+			if !reflect.DeepEqual(changed, tt.wantChanged) {
+				t.Errorf("changed common platforms = %q, want %q", changed, tt.wantChanged)
+			}
+			wantDiff := len(tt.wantAdded) > 0 || len(tt.wantRemoved) > 0 || len(tt.wantChanged) > 0
+			if diff.Changed() != wantDiff {
+				t.Errorf("Changed() = %v, want %v", diff.Changed(), wantDiff)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package inspect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	remoteerrors "github.com/containerd/containerd/v2/core/remotes/errors"
+	"github.com/containerd/errdefs"
+)
+
+// ErrorCode identifies the kind of failure of an image query. The values are
+// stable and are returned to clients of the mquery backend.
+type ErrorCode string
+
+const (
+	// CodeInvalidName is returned for image names that cannot be parsed
+	CodeInvalidName ErrorCode = "INVALID_NAME"
+	// CodeNotFound is returned when the repository, tag or digest doesn't exist
+	CodeNotFound ErrorCode = "NOT_FOUND"
+	// CodeUnauthorized is returned when the registry requires authentication
+	// that wasn't provided or wasn't accepted
+	CodeUnauthorized ErrorCode = "UNAUTHORIZED"
+	// CodeDenied is returned when the credentials don't grant access to the image
+	CodeDenied ErrorCode = "DENIED"
+	// CodeRateLimited is returned when the registry rejects the request with
+	// 429 Too Many Requests
+	CodeRateLimited ErrorCode = "RATE_LIMITED"
+	// CodeUnavailable is returned when the registry can't be reached or
+	// responds with a server error
+	CodeUnavailable ErrorCode = "REGISTRY_UNAVAILABLE"
+	// CodeTimeout is returned when the registry doesn't respond in time
+	CodeTimeout ErrorCode = "TIMEOUT"
+	// CodeUnsupportedMediaType is returned for manifests mquery can't interpret
+	CodeUnsupportedMediaType ErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+	// CodeInternal is returned for any other failure
+	CodeInternal ErrorCode = "INTERNAL"
+)
+
+// Error is the error returned by QueryRegistry and ResolveDigest, carrying
+// the ErrorCode for the failure
+type Error struct {
+	Code ErrorCode
+	Err  error
+	// RateLimit is the registry's rate limit status, if it reported one
+	RateLimit *RateLimit
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Code returns the ErrorCode of err, or CodeInternal if err is not an *Error
+func Code(err error) ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeInternal
+}
+
+// RateLimitOf returns the registry rate limit status reported with err, or
+// nil if there is none
+func RateLimitOf(err error) *RateLimit {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.RateLimit
+	}
+	return nil
+}
+
+// withRateLimit records the registry's rate limit status in err, an *Error
+// returned by classify
+func withRateLimit(err error, rl *RateLimit) error {
+	if e, ok := err.(*Error); ok && rl != nil {
+		e.RateLimit = rl
+	}
+	return err
+}
+
+// classify wraps a registry access error in an *Error with the matching code.
+// Any failure after ctx's deadline has passed is reported as a timeout, as
+// the underlying error may only be a cancelled request.
+func classify(ctx context.Context, err error) error {
+	var e *Error
+	if err == nil || errors.As(err, &e) {
+		return err
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &Error{Code: CodeTimeout, Err: fmt.Errorf("timed out waiting for the registry: %w", err)}
+	}
+	return &Error{Code: errorCode(err), Err: err}
+}
+
+func errorCode(err error) ErrorCode {
+	var statusErr remoteerrors.ErrUnexpectedStatus
+	var netErr net.Error
+	switch {
+	case errdefs.IsNotFound(err):
+		return CodeNotFound
+	case errors.Is(err, docker.ErrInvalidAuthorization):
+		return CodeUnauthorized
+	case errors.As(err, &statusErr):
+		switch {
+		case statusErr.StatusCode == http.StatusUnauthorized:
+			return CodeUnauthorized
+		case statusErr.StatusCode == http.StatusForbidden:
+			return CodeDenied
+		case statusErr.StatusCode == http.StatusNotFound:
+			return CodeNotFound
+		case statusErr.StatusCode == http.StatusTooManyRequests:
+			return CodeRateLimited
+		case statusErr.StatusCode == http.StatusGatewayTimeout:
+			return CodeTimeout
+		case statusErr.StatusCode >= 500:
+			return CodeUnavailable
+		}
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeTimeout
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return CodeTimeout
+		}
+		return CodeUnavailable
+	}
+	return CodeInternal
+}
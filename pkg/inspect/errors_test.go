@@ -0,0 +1,66 @@
+package inspect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	remoteerrors "github.com/containerd/containerd/v2/core/remotes/errors"
+	"github.com/containerd/errdefs"
+)
+
+func TestClassify(t *testing.T) {
+	status := func(code int) error {
+		return fmt.Errorf("failed to resolve: %w", remoteerrors.ErrUnexpectedStatus{Status: http.StatusText(code), StatusCode: code})
+	}
+	tests := []struct {
+		name string
+		err  error
+		// expired runs the query with a context whose deadline has passed
+		expired bool
+		want    ErrorCode
+	}{
+		{name: "not found", err: fmt.Errorf("app:latest: %w", errdefs.ErrNotFound), want: CodeNotFound},
+		{name: "invalid authorization", err: fmt.Errorf("pull access denied: %w", docker.ErrInvalidAuthorization), want: CodeUnauthorized},
+		{name: "401", err: status(http.StatusUnauthorized), want: CodeUnauthorized},
+		{name: "403", err: status(http.StatusForbidden), want: CodeDenied},
+		{name: "404", err: status(http.StatusNotFound), want: CodeNotFound},
+		{name: "429", err: status(http.StatusTooManyRequests), want: CodeRateLimited},
+		{name: "500", err: status(http.StatusInternalServerError), want: CodeUnavailable},
+		{name: "503", err: status(http.StatusServiceUnavailable), want: CodeUnavailable},
+		{name: "504", err: status(http.StatusGatewayTimeout), want: CodeTimeout},
+		{name: "400", err: status(http.StatusBadRequest), want: CodeInternal},
+		{name: "deadline exceeded", err: fmt.Errorf("fetch: %w", context.DeadlineExceeded), want: CodeTimeout},
+		{name: "network timeout", err: &net.DNSError{Err: "i/o timeout", Name: "registry.example.com", IsTimeout: true}, want: CodeTimeout},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, want: CodeUnavailable},
+		{name: "other", err: errors.New("unexpected end of JSON input"), want: CodeInternal},
+		{name: "already classified", err: &Error{Code: CodeUnsupportedMediaType, Err: errors.New("Unknown descriptor type")}, want: CodeUnsupportedMediaType},
+		{name: "after the deadline", err: errors.New("request canceled"), expired: true, want: CodeTimeout},
+		{name: "classified before the deadline", err: &Error{Code: CodeNotFound, Err: errdefs.ErrNotFound}, expired: true, want: CodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.expired {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithDeadline(ctx, time.Now().Add(-time.Second))
+				defer cancel()
+			}
+			err := classify(ctx, tt.err)
+			if got := Code(err); got != tt.want {
+				t.Errorf("Code(classify(%v)) = %s, want %s", tt.err, got, tt.want)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Errorf("classify(%v) = %v, which doesn't wrap the error", tt.err, err)
+			}
+		})
+	}
+	if err := classify(context.Background(), nil); err != nil {
+		t.Errorf("classify(nil) = %v, want nil", err)
+	}
+}
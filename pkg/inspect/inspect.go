@@ -0,0 +1,386 @@
+package inspect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/estesp/manifest-tool/v2/pkg/registry"
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/estesp/manifest-tool/v2/pkg/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// maxIndexDepth limits how deeply nested indexes are followed
+const maxIndexDepth = 8
+
+// manifestMediaTypes are the manifest and index media types accepted when
+// fetching an image
+var manifestMediaTypes = []string{
+	types.MediaTypeDockerSchema2Manifest,
+	types.MediaTypeDockerSchema2ManifestList,
+	ocispec.MediaTypeImageManifest,
+	ocispec.MediaTypeImageIndex,
+}
+
+// annotations used by BuildKit to mark attestation manifests in an index
+const (
+	annotationReferenceType   = "vnd.docker.reference.type"
+	annotationReferenceDigest = "vnd.docker.reference.digest"
+	annotationPredicateType   = "in-toto.io/predicate-type"
+)
+
+// Image represents the JSON metadata about an image returned by the
+// mquery backend and by direct registry queries
+type Image struct {
+	CacheTS   int64              `json:"cachets"`
+	IsList    bool               `json:"islist"`
+	ImageName string             `json:"imagename"`
+	Digest    string             `json:"digest"`
+	MediaType string             `json:"mediatype"`
+	ArchList  []ocispec.Platform `json:"archlist"`
+	// Manifests describes the manifest serving each platform in ArchList, in
+	// the same order
+	Manifests []PlatformManifest `json:"manifests,omitempty"`
+	// ArtifactType is set when the manifest describes an OCI artifact (such
+	// as a Helm chart, WASM module or cosign signature) rather than a
+	// container image. Artifacts may not have a platform, in which case
+	// ArchList and Manifests are empty.
+	ArtifactType string `json:"artifacttype,omitempty"`
+	// Attestations lists the attestation manifests (e.g. BuildKit provenance
+	// and SBOMs) found in an index; they are not included in ArchList
+	Attestations []Attestation `json:"attestations,omitempty"`
+	// Endpoint is the registry endpoint (scheme and host) that served the
+	// manifest, which is a mirror when one is configured and has the image
+	Endpoint string `json:"endpoint,omitempty"`
+	// RateLimit is the registry's pull rate limit status after the query,
+	// reported by registries such as Docker Hub
+	RateLimit *RateLimit `json:"ratelimit,omitempty"`
+}
+
+// PlatformManifest describes the manifest for a single platform of an image
+type PlatformManifest struct {
+	Platform    ocispec.Platform  `json:"platform"`
+	Digest      string            `json:"digest"`
+	MediaType   string            `json:"mediatype"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// IndexPath lists the digests of the nested indexes, outermost first,
+	// through which the manifest was found; it is empty for manifests listed
+	// directly in the image's index
+	IndexPath []string `json:"indexpath,omitempty"`
+	// Details is only populated for deep queries
+	Details *Details `json:"details,omitempty"`
+}
+
+// Attestation describes an attestation manifest in an index and the platform
+// manifest it refers to
+type Attestation struct {
+	Digest    string `json:"digest"`
+	MediaType string `json:"mediatype"`
+	// Type is the value of the vnd.docker.reference.type annotation
+	Type string `json:"type"`
+	// Reference is the digest of the platform manifest the attestation is for
+	Reference string `json:"reference"`
+	// Platform is the platform of the referenced manifest, if found in the index
+	Platform *ocispec.Platform `json:"platform,omitempty"`
+	// PredicateTypes lists the in-toto predicate types carried by the
+	// attestation's layers, such as SLSA provenance or SPDX documents
+	PredicateTypes []string `json:"predicatetypes,omitempty"`
+}
+
+// Options controls how the registry is accessed when querying an image
+type Options struct {
+	// Username and Password are used to authenticate to the registry; when
+	// both are empty, credentials are looked up in the Docker config
+	Username string
+	Password string
+	// DockerConfig is the directory holding the Docker config.json used for
+	// credential lookup; defaults to $DOCKER_CONFIG or ~/.docker
+	DockerConfig string
+	// IgnoreDockerConfig skips the Docker config and credential helper
+	// lookup, so only the explicit credentials are used; a shared service
+	// sets it so callers can't query private images with its own credentials
+	IgnoreDockerConfig bool
+	// Token is a bearer token sent as-is to the registry, taking precedence
+	// over any username/password or Docker config credentials
+	Token string
+	// Registry is the registry host (as in image names, e.g. docker.io or
+	// registry.example.com:5000) that Token, Username and Password belong
+	// to. They are only sent to that registry, never to other registries or
+	// mirrors, and are not sent at all if Registry is empty.
+	Registry string
+	// Deep adds the image config and layer details for each platform
+	Deep bool
+	// PlainHTTP accesses the registry over plain HTTP instead of HTTPS
+	PlainHTTP bool
+	// Insecure skips verification of the registry's TLS certificate, and
+	// falls back to plain HTTP if the registry doesn't support HTTPS
+	Insecure bool
+	// InsecureRegistries lists the registry hosts (with an optional port)
+	// that are accessed as if Insecure was set
+	InsecureRegistries []string
+	// LocalPlainHTTP falls back to plain HTTP for registries on localhost or
+	// a loopback address if they don't support HTTPS. It should only be set
+	// for client-side queries: a server would expose its local services.
+	LocalPlainHTTP bool
+	// HostsDir is a directory of containerd-style registry host
+	// configurations (<dir>/<registry>/hosts.toml) listing mirrors to try
+	// before the upstream registry
+	HostsDir string
+}
+
+// QueryRegistry retrieves the manifest or index for the named image from its
+// registry and returns the platform information for it. The image name in the
+// result is the canonical form of name (see CanonicalName). Errors are
+// returned as an *Error classifying the failure; if ctx's deadline passes
+// before the registry responds, its code is CodeTimeout.
+func QueryRegistry(ctx context.Context, name string, opts Options) (image *Image, err error) {
+	ctx, span := tracer.Start(ctx, "inspect.QueryRegistry", trace.WithAttributes(attribute.String("mquery.image", name)))
+	defer func() { endSpan(span, err) }()
+	recorder := &responseRecorder{}
+	image, err = queryRegistry(ctx, name, opts, recorder)
+	if err != nil {
+		return nil, withRateLimit(classify(ctx, err), recorder.RateLimit())
+	}
+	image.RateLimit = recorder.RateLimit()
+	span.SetAttributes(attribute.String("mquery.digest", image.Digest), attribute.String("mquery.endpoint", image.Endpoint))
+	return image, nil
+}
+
+func queryRegistry(ctx context.Context, name string, opts Options, recorder *responseRecorder) (*Image, error) {
+	var image *Image
+	imageRef, err := parseReference(name)
+	if err != nil {
+		return nil, err
+	}
+
+	resolver := newResolver(imageRef, opts, recorder)
+	resolvedName, desc, err := resolver.Resolve(ctx, imageRef.String())
+	if err != nil {
+		return nil, err
+	}
+	// containerd refuses to fetch schema1 manifests, so they are read
+	// separately
+	if isSchema1(desc.MediaType) {
+		image, err := schema1Image(ctx, resolver, imageRef, desc)
+		if err != nil {
+			return nil, err
+		}
+		image.Endpoint = recorder.Endpoint()
+		return image, nil
+	}
+	memoryStore := store.NewMemoryStore()
+	resolver = resolvedResolver{Resolver: resolver, ref: imageRef.String(), name: resolvedName, desc: desc}
+	descriptor, err := registry.Fetch(ctx, memoryStore, types.NewRequest(imageRef, "", manifestMediaTypes, resolver))
+	if err != nil {
+		return nil, err
+	}
+
+	_, db, _ := memoryStore.Get(descriptor)
+	switch descriptor.MediaType {
+	case ocispec.MediaTypeImageIndex, types.MediaTypeDockerSchema2ManifestList:
+		// this is a multi-platform image descriptor; marshal to Index type
+		var idx ocispec.Index
+		if err := json.Unmarshal(db, &idx); err != nil {
+			return nil, err
+		}
+		image = generateImage(imageRef.String(), memoryStore, descriptor, idx, ocispec.Image{})
+	case ocispec.MediaTypeImageManifest, types.MediaTypeDockerSchema2Manifest:
+		var man ocispec.Manifest
+		if err := json.Unmarshal(db, &man); err != nil {
+			return nil, err
+		}
+		artifact := artifactType(man)
+		_, cb, _ := memoryStore.Get(man.Config)
+		var conf ocispec.Image
+		// an artifact's config may be in any format; it only provides the
+		// platform if it happens to be compatible with an image config
+		if err := json.Unmarshal(cb, &conf); err != nil && artifact == "" {
+			return nil, err
+		}
+		image = generateImage(imageRef.String(), memoryStore, descriptor, ocispec.Index{}, conf)
+		image.ArtifactType = artifact
+	default:
+		return nil, &Error{Code: CodeUnsupportedMediaType, Err: errors.New("Unknown descriptor type: " + descriptor.MediaType)}
+	}
+	if opts.Deep {
+		if err := addDetails(memoryStore, image); err != nil {
+			return nil, err
+		}
+	}
+	image.Endpoint = recorder.Endpoint()
+	return image, nil
+}
+
+// ResolveDigest returns the current digest of the named image's manifest or
+// index. It only issues a HEAD request for the reference, so it is much
+// cheaper than QueryRegistry for checking whether an image has changed.
+func ResolveDigest(ctx context.Context, name string, opts Options) (digest string, err error) {
+	ctx, span := tracer.Start(ctx, "inspect.ResolveDigest", trace.WithAttributes(attribute.String("mquery.image", name)))
+	defer func() { endSpan(span, err) }()
+	imageRef, err := parseReference(name)
+	if err != nil {
+		return "", err
+	}
+	resolver := newResolver(imageRef, opts, nil)
+	_, desc, err := resolver.Resolve(ctx, imageRef.String())
+	if err != nil {
+		return "", classify(ctx, err)
+	}
+	return desc.Digest.String(), nil
+}
+
+// artifactType returns the type of the artifact described by man, or "" if
+// it is a container image. The type is the manifest's artifactType, or else
+// the config media type for non-image configs (e.g. Helm charts and WASM
+// modules), or else the layer media type when there are no filesystem layers
+// (e.g. cosign signatures, which use an image config).
+func artifactType(man ocispec.Manifest) string {
+	if man.ArtifactType != "" {
+		return man.ArtifactType
+	}
+	if !images.IsConfigType(man.Config.MediaType) {
+		return man.Config.MediaType
+	}
+	for _, layer := range man.Layers {
+		if images.IsLayerType(layer.MediaType) {
+			return ""
+		}
+	}
+	if len(man.Layers) > 0 {
+		return man.Layers[0].MediaType
+	}
+	return ""
+}
+
+func generateImage(name string, cs *store.MemoryStore, desc ocispec.Descriptor, index ocispec.Index, imgConfig ocispec.Image) *Image {
+	image := new(Image)
+	image.Digest = desc.Digest.String()
+	image.MediaType = desc.MediaType
+	image.ImageName = name
+	image.CacheTS = time.Now().Unix()
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex, types.MediaTypeDockerSchema2ManifestList:
+		image.IsList = true
+		addIndex(cs, image, index, nil)
+		// attestations refer to platform manifests anywhere in the image,
+		// including nested indexes
+		for i, att := range image.Attestations {
+			for _, m := range image.Manifests {
+				if m.Digest == att.Reference {
+					platform := m.Platform
+					image.Attestations[i].Platform = &platform
+					break
+				}
+			}
+		}
+	default:
+		// artifacts such as Helm charts or signatures may not have a platform
+		if imgConfig.OS == "" && imgConfig.Architecture == "" {
+			break
+		}
+		// the config carries the full platform (including variant, OS version
+		// and OS features), just as an index entry's descriptor does
+		image.ArchList = []ocispec.Platform{imgConfig.Platform}
+		image.Manifests = []PlatformManifest{platformManifest(imgConfig.Platform, desc)}
+	}
+	return image
+}
+
+func platformManifest(platform ocispec.Platform, desc ocispec.Descriptor) PlatformManifest {
+	return PlatformManifest{
+		Platform:    platform,
+		Digest:      desc.Digest.String(),
+		MediaType:   desc.MediaType,
+		Size:        desc.Size,
+		Annotations: desc.Annotations,
+	}
+}
+
+// addIndex adds the platforms and attestations of index to image. Nested
+// indexes, which were fetched into the memory store along with the top-level
+// index, are walked recursively and their platforms are flattened into the
+// image, recording the path of index digests they were found through.
+func addIndex(cs *store.MemoryStore, image *Image, index ocispec.Index, path []string) {
+	for _, img := range index.Manifests {
+		// attestation entries in the manifest list aren't platforms; report
+		// them separately
+		if refType, ok := img.Annotations[annotationReferenceType]; ok {
+			image.Attestations = append(image.Attestations, attestation(cs, img, refType))
+			continue
+		}
+		if images.IsIndexType(img.MediaType) {
+			var nested ocispec.Index
+			_, b, ok := cs.Get(img)
+			if !ok || len(path) >= maxIndexDepth || json.Unmarshal(b, &nested) != nil {
+				continue
+			}
+			addIndex(cs, image, nested, append(path[:len(path):len(path)], img.Digest.String()))
+			continue
+		}
+		platform, ok := entryPlatform(cs, img)
+		if !ok {
+			// entries without a platform, such as signatures stored in the
+			// index, aren't platforms of the image
+			continue
+		}
+		manifest := platformManifest(platform, img)
+		manifest.IndexPath = path
+		image.ArchList = append(image.ArchList, platform)
+		image.Manifests = append(image.Manifests, manifest)
+	}
+}
+
+// entryPlatform returns the platform of an index entry, falling back to the
+// platform in the entry's image config if the index doesn't specify one
+func entryPlatform(cs *store.MemoryStore, desc ocispec.Descriptor) (ocispec.Platform, bool) {
+	if desc.Platform != nil {
+		return *desc.Platform, true
+	}
+	_, mb, ok := cs.Get(desc)
+	if !ok {
+		return ocispec.Platform{}, false
+	}
+	var man ocispec.Manifest
+	if err := json.Unmarshal(mb, &man); err != nil || !images.IsConfigType(man.Config.MediaType) {
+		return ocispec.Platform{}, false
+	}
+	_, cb, ok := cs.Get(man.Config)
+	if !ok {
+		return ocispec.Platform{}, false
+	}
+	var conf ocispec.Image
+	if err := json.Unmarshal(cb, &conf); err != nil || conf.OS == "" || conf.Architecture == "" {
+		return ocispec.Platform{}, false
+	}
+	return conf.Platform, true
+}
+
+// attestation describes the attestation manifest desc found in an index
+func attestation(cs *store.MemoryStore, desc ocispec.Descriptor, refType string) Attestation {
+	att := Attestation{
+		Digest:    desc.Digest.String(),
+		MediaType: desc.MediaType,
+		Type:      refType,
+		Reference: desc.Annotations[annotationReferenceDigest],
+	}
+	// the attestation manifest itself was fetched with the index; its layers
+	// are annotated with the in-toto predicate type of each statement
+	if _, mb, ok := cs.Get(desc); ok {
+		var man ocispec.Manifest
+		if err := json.Unmarshal(mb, &man); err == nil {
+			for _, layer := range man.Layers {
+				if pt, ok := layer.Annotations[annotationPredicateType]; ok {
+					att.PredicateTypes = append(att.PredicateTypes, pt)
+				}
+			}
+		}
+	}
+	return att
+}
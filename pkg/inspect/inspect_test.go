@@ -0,0 +1,262 @@
+package inspect
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/estesp/manifest-tool/v2/pkg/store"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+const (
+	predicateSLSA = "https://slsa.dev/provenance/v0.2"
+	predicateSPDX = "https://spdx.dev/Document"
+)
+
+var (
+	linuxAMD64   = ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	linuxARM64   = ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}
+	linuxPPC64LE = ocispec.Platform{OS: "linux", Architecture: "ppc64le"}
+	windowsAMD64 = ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.2300"}
+)
+
+// storeJSON adds v to the store as a blob of the media type and returns its
+// descriptor
+func storeJSON(t *testing.T, cs *store.MemoryStore, mediaType string, v interface{}) ocispec.Descriptor {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(b), Size: int64(len(b))}
+	cs.Set(desc, b)
+	return desc
+}
+
+// storeManifest adds an image manifest, and a config with the platform, to
+// the store and returns the manifest's descriptor, which has no platform
+func storeManifest(t *testing.T, cs *store.MemoryStore, platform ocispec.Platform) ocispec.Descriptor {
+	t.Helper()
+	config := storeJSON(t, cs, ocispec.MediaTypeImageConfig, ocispec.Image{Platform: platform})
+	return storeJSON(t, cs, ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    config,
+	})
+}
+
+// platformEntry returns an index entry for a manifest of the platform; the
+// manifest isn't stored, as it is only needed for its platform
+func platformEntry(platform ocispec.Platform) ocispec.Descriptor {
+	p := platform
+	return ocispec.Descriptor{
+		MediaType: ocispec.MediaTypeImageManifest,
+		Digest:    digest.FromString(platform.OS + "/" + platform.Architecture + "/" + platform.Variant),
+		Size:      500,
+		Platform:  &p,
+	}
+}
+
+// storeAttestation adds an attestation manifest for the entry, with a layer
+// for each predicate type, and returns its index entry
+func storeAttestation(t *testing.T, cs *store.MemoryStore, entry ocispec.Descriptor, predicateTypes ...string) ocispec.Descriptor {
+	t.Helper()
+	man := ocispec.Manifest{MediaType: ocispec.MediaTypeImageManifest}
+	for _, pt := range predicateTypes {
+		man.Layers = append(man.Layers, ocispec.Descriptor{
+			MediaType:   "application/vnd.in-toto+json",
+			Digest:      digest.FromString(pt),
+			Annotations: map[string]string{annotationPredicateType: pt},
+		})
+	}
+	desc := storeJSON(t, cs, ocispec.MediaTypeImageManifest, man)
+	desc.Platform = &ocispec.Platform{OS: "unknown", Architecture: "unknown"}
+	desc.Annotations = map[string]string{
+		annotationReferenceType:   "attestation-manifest",
+		annotationReferenceDigest: entry.Digest.String(),
+	}
+	return desc
+}
+
+// nestIndex wraps the index in depth nested indexes, returning the outermost
+// index and the digests of the nested indexes, outermost first
+func nestIndex(t *testing.T, cs *store.MemoryStore, index ocispec.Index, depth int) (ocispec.Index, []string) {
+	t.Helper()
+	var path []string
+	for i := 0; i < depth; i++ {
+		desc := storeJSON(t, cs, ocispec.MediaTypeImageIndex, index)
+		index = ocispec.Index{MediaType: ocispec.MediaTypeImageIndex, Manifests: []ocispec.Descriptor{desc}}
+		path = append([]string{desc.Digest.String()}, path...)
+	}
+	return index, path
+}
+
+func TestGenerateImage(t *testing.T) {
+	indexDesc := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageIndex, Digest: digest.FromString("index")}
+	manifestDesc := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: digest.FromString("manifest")}
+
+	// expected is the part of the image checked by each test
+	type expected struct {
+		archList     []ocispec.Platform
+		indexPaths   [][]string
+		attestations []Attestation
+	}
+	tests := []struct {
+		name string
+		// build stores the image's content and returns the generateImage
+		// arguments and the expected result
+		build func(t *testing.T, cs *store.MemoryStore) (ocispec.Descriptor, ocispec.Index, ocispec.Image, expected)
+	}{
+		{
+			name: "index",
+			build: func(t *testing.T, cs *store.MemoryStore) (ocispec.Descriptor, ocispec.Index, ocispec.Image, expected) {
+				index := ocispec.Index{Manifests: []ocispec.Descriptor{platformEntry(linuxAMD64), platformEntry(windowsAMD64)}}
+				return indexDesc, index, ocispec.Image{}, expected{
+					archList:   []ocispec.Platform{linuxAMD64, windowsAMD64},
+					indexPaths: [][]string{nil, nil},
+				}
+			},
+		},
+		{
+			name: "platform from image config",
+			build: func(t *testing.T, cs *store.MemoryStore) (ocispec.Descriptor, ocispec.Index, ocispec.Image, expected) {
+				index := ocispec.Index{Manifests: []ocispec.Descriptor{storeManifest(t, cs, linuxPPC64LE)}}
+				return indexDesc, index, ocispec.Image{}, expected{
+					archList:   []ocispec.Platform{linuxPPC64LE},
+					indexPaths: [][]string{nil},
+				}
+			},
+		},
+		{
+			name: "entries without a platform",
+			build: func(t *testing.T, cs *store.MemoryStore) (ocispec.Descriptor, ocispec.Index, ocispec.Image, expected) {
+				// a signature with a non-image config, and a manifest
+				// missing from the store
+				config := storeJSON(t, cs, "application/vnd.dev.cosign.artifact.sig.v1+json", struct{}{})
+				signature := storeJSON(t, cs, ocispec.MediaTypeImageManifest, ocispec.Manifest{Config: config})
+				missing := ocispec.Descriptor{MediaType: ocispec.MediaTypeImageManifest, Digest: digest.FromString("missing")}
+				index := ocispec.Index{Manifests: []ocispec.Descriptor{platformEntry(linuxAMD64), signature, missing}}
+				return indexDesc, index, ocispec.Image{}, expected{
+					archList:   []ocispec.Platform{linuxAMD64},
+					indexPaths: [][]string{nil},
+				}
+			},
+		},
+		{
+			name: "nested index",
+			build: func(t *testing.T, cs *store.MemoryStore) (ocispec.Descriptor, ocispec.Index, ocispec.Image, expected) {
+				nested, path := nestIndex(t, cs, ocispec.Index{Manifests: []ocispec.Descriptor{platformEntry(linuxARM64)}}, 2)
+				index := ocispec.Index{Manifests: append([]ocispec.Descriptor{platformEntry(linuxAMD64)}, nested.Manifests...)}
+				return indexDesc, index, ocispec.Image{}, expected{
+					archList:   []ocispec.Platform{linuxAMD64, linuxARM64},
+					indexPaths: [][]string{nil, path},
+				}
+			},
+		},
+		{
+			name: "maximum depth",
+			build: func(t *testing.T, cs *store.MemoryStore) (ocispec.Descriptor, ocispec.Index, ocispec.Image, expected) {
+				index, path := nestIndex(t, cs, ocispec.Index{Manifests: []ocispec.Descriptor{platformEntry(linuxARM64)}}, maxIndexDepth)
+				return indexDesc, index, ocispec.Image{}, expected{
+					archList:   []ocispec.Platform{linuxARM64},
+					indexPaths: [][]string{path},
+				}
+			},
+		},
+		{
+			name: "over maximum depth",
+			build: func(t *testing.T, cs *store.MemoryStore) (ocispec.Descriptor, ocispec.Index, ocispec.Image, expected) {
+				index, _ := nestIndex(t, cs, ocispec.Index{Manifests: []ocispec.Descriptor{platformEntry(linuxARM64)}}, maxIndexDepth+1)
+				index.Manifests = append(index.Manifests, platformEntry(linuxAMD64))
+				return indexDesc, index, ocispec.Image{}, expected{
+					archList:   []ocispec.Platform{linuxAMD64},
+					indexPaths: [][]string{nil},
+				}
+			},
+		},
+		{
+			name: "attestations",
+			build: func(t *testing.T, cs *store.MemoryStore) (ocispec.Descriptor, ocispec.Index, ocispec.Image, expected) {
+				amd64 := platformEntry(linuxAMD64)
+				arm64 := platformEntry(linuxARM64)
+				nested, _ := nestIndex(t, cs, ocispec.Index{Manifests: []ocispec.Descriptor{arm64}}, 1)
+				unknown := ocispec.Descriptor{Digest: digest.FromString("unknown")}
+				amd64Att := storeAttestation(t, cs, amd64, predicateSLSA, predicateSPDX)
+				arm64Att := storeAttestation(t, cs, arm64)
+				unknownAtt := storeAttestation(t, cs, unknown, predicateSLSA)
+				index := ocispec.Index{Manifests: []ocispec.Descriptor{amd64, amd64Att, nested.Manifests[0], arm64Att, unknownAtt}}
+				return indexDesc, index, ocispec.Image{}, expected{
+					archList:   []ocispec.Platform{linuxAMD64, linuxARM64},
+					indexPaths: [][]string{nil, {nested.Manifests[0].Digest.String()}},
+					attestations: []Attestation{
+						{
+							Digest:         amd64Att.Digest.String(),
+							MediaType:      ocispec.MediaTypeImageManifest,
+							Type:           "attestation-manifest",
+							Reference:      amd64.Digest.String(),
+							Platform:       &linuxAMD64,
+							PredicateTypes: []string{predicateSLSA, predicateSPDX},
+						},
+						{
+							Digest:    arm64Att.Digest.String(),
+							MediaType: ocispec.MediaTypeImageManifest,
+							Type:      "attestation-manifest",
+							Reference: arm64.Digest.String(),
+							Platform:  &linuxARM64,
+						},
+						{
+							Digest:         unknownAtt.Digest.String(),
+							MediaType:      ocispec.MediaTypeImageManifest,
+							Type:           "attestation-manifest",
+							Reference:      unknown.Digest.String(),
+							PredicateTypes: []string{predicateSLSA},
+						},
+					},
+				}
+			},
+		},
+		{
+			name: "manifest",
+			build: func(t *testing.T, cs *store.MemoryStore) (ocispec.Descriptor, ocispec.Index, ocispec.Image, expected) {
+				return manifestDesc, ocispec.Index{}, ocispec.Image{Platform: windowsAMD64}, expected{
+					archList:   []ocispec.Platform{windowsAMD64},
+					indexPaths: [][]string{nil},
+				}
+			},
+		},
+		{
+			name: "artifact without a platform",
+			build: func(t *testing.T, cs *store.MemoryStore) (ocispec.Descriptor, ocispec.Index, ocispec.Image, expected) {
+				return manifestDesc, ocispec.Index{}, ocispec.Image{}, expected{}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := store.NewMemoryStore()
+			desc, index, config, want := tt.build(t, cs)
+			image := generateImage("registry.example.com/app:latest", cs, desc, index, config)
+
+			if isList := desc.MediaType == ocispec.MediaTypeImageIndex; image.IsList != isList {
+				t.Errorf("IsList = %v, want %v", image.IsList, isList)
+			}
+			if image.Digest != desc.Digest.String() {
+				t.Errorf("Digest = %s, want %s", image.Digest, desc.Digest)
+			}
+			if !reflect.DeepEqual(image.ArchList, want.archList) {
+				t.Errorf("ArchList = %+v, want %+v", image.ArchList, want.archList)
+			}
+			var paths [][]string
+			for _, m := range image.Manifests {
+				paths = append(paths, m.IndexPath)
+			}
+			if !reflect.DeepEqual(paths, want.indexPaths) {
+				t.Errorf("IndexPaths = %q, want %q", paths, want.indexPaths)
+			}
+			if !reflect.DeepEqual(image.Attestations, want.attestations) {
+				t.Errorf("Attestations = %+v, want %+v", image.Attestations, want.attestations)
+			}
+		})
+	}
+}
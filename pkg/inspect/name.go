@@ -0,0 +1,65 @@
+package inspect
+
+import (
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+)
+
+// parseReference parses an image name into a fully qualified reference,
+// adding the "latest" tag if neither a tag nor a digest is given
+func parseReference(name string) (reference.Named, error) {
+	ref, err := util.ParseName(name)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidName, Err: err}
+	}
+	return reference.TagNameOnly(ref), nil
+}
+
+// CanonicalName returns the normalized form of an image name, so that
+// equivalent names such as "alpine", "library/alpine" and
+// "docker.io/library/alpine:latest" compare equal. pinned reports whether the
+// name includes a digest, in which case it always refers to the same image.
+func CanonicalName(name string) (canonical string, pinned bool, err error) {
+	ref, err := parseReference(name)
+	if err != nil {
+		return "", false, err
+	}
+	_, pinned = ref.(reference.Canonical)
+	return ref.String(), pinned, nil
+}
+
+// Registry returns the registry host of the named image, such as docker.io
+// for "alpine"
+func Registry(name string) (string, error) {
+	ref, err := parseReference(name)
+	if err != nil {
+		return "", err
+	}
+	return reference.Domain(ref), nil
+}
+
+// CommonRegistry returns the registry host of all the named images, or "" if
+// they are on different registries or any name is invalid
+func CommonRegistry(names []string) string {
+	common := ""
+	for _, name := range names {
+		registry, err := Registry(name)
+		if err != nil || (common != "" && registry != common) {
+			return ""
+		}
+		common = registry
+	}
+	return common
+}
+
+// registryHostname returns the host serving the registry API for a registry
+// host as used in image names
+func registryHostname(registry string) string {
+	switch strings.ToLower(registry) {
+	case util.DefaultHostname, util.LegacyDefaultHostname, "registry-1.docker.io":
+		return "registry-1.docker.io"
+	}
+	return registry
+}
@@ -0,0 +1,66 @@
+package inspect
+
+import "testing"
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestCanonicalName(t *testing.T) {
+	tests := []struct {
+		name       string
+		want       string
+		wantPinned bool
+		wantErr    bool
+	}{
+		{name: "alpine", want: "docker.io/library/alpine:latest"},
+		{name: "alpine:3.18", want: "docker.io/library/alpine:3.18"},
+		{name: "library/alpine", want: "docker.io/library/alpine:latest"},
+		{name: "docker.io/library/alpine:latest", want: "docker.io/library/alpine:latest"},
+		{name: "index.docker.io/library/alpine", want: "docker.io/library/alpine:latest"},
+		{name: "estesp/mquery:1.0", want: "docker.io/estesp/mquery:1.0"},
+		{name: "registry.example.com/app", want: "registry.example.com/app:latest"},
+		{name: "registry.example.com:5000/team/app:2", want: "registry.example.com:5000/team/app:2"},
+		{name: "localhost:5000/app", want: "localhost:5000/app:latest"},
+		{name: "alpine@" + testDigest, want: "docker.io/library/alpine@" + testDigest, wantPinned: true},
+		{name: "registry.example.com:5000/app:2@" + testDigest, want: "registry.example.com:5000/app:2@" + testDigest, wantPinned: true},
+		{name: "Alpine", wantErr: true},
+		{name: "alpine@sha256:short", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, pinned, err := CanonicalName(tt.name)
+			if tt.wantErr {
+				if Code(err) != CodeInvalidName {
+					t.Fatalf("CanonicalName(%q) error = %v, want an %s error", tt.name, err, CodeInvalidName)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want || pinned != tt.wantPinned {
+				t.Errorf("CanonicalName(%q) = %q, %v, want %q, %v", tt.name, got, pinned, tt.want, tt.wantPinned)
+			}
+		})
+	}
+}
+
+func TestCommonRegistry(t *testing.T) {
+	tests := []struct {
+		names []string
+		want  string
+	}{
+		{[]string{"alpine", "library/busybox:1.36"}, "docker.io"},
+		{[]string{"alpine", "docker.io/estesp/mquery", "index.docker.io/library/busybox"}, "docker.io"},
+		{[]string{"registry.example.com/app", "registry.example.com/db:2"}, "registry.example.com"},
+		{[]string{"registry.example.com:5000/app", "registry.example.com:5000/db@" + testDigest}, "registry.example.com:5000"},
+		{[]string{"registry.example.com/app", "registry.example.com:5000/app"}, ""},
+		{[]string{"alpine", "registry.example.com/app"}, ""},
+		{[]string{"alpine", "Alpine"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := CommonRegistry(tt.names); got != tt.want {
+			t.Errorf("CommonRegistry(%q) = %q, want %q", tt.names, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package inspect
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/containerd/platforms"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ParsePlatform parses a platform in the "os/arch[/variant][:osversion]" form
+// used in mquery output (for example "linux/arm64/v8" or
+// "windows/amd64:10.0.17763"). Both the OS and architecture are required.
+func ParsePlatform(specifier string) (ocispec.Platform, error) {
+	spec, osVersion, _ := strings.Cut(specifier, ":")
+	if !strings.Contains(spec, "/") {
+		return ocispec.Platform{}, fmt.Errorf("invalid platform %q: must be in the form os/arch[/variant]", specifier)
+	}
+	p, err := platforms.Parse(spec)
+	if err != nil {
+		return ocispec.Platform{}, fmt.Errorf("invalid platform %q: %w", specifier, err)
+	}
+	if osVersion != "" {
+		p.OSVersion = osVersion
+	}
+	return p, nil
+}
+
+// MatchPlatform reports whether the image platform p satisfies the required
+// platform. OS and architecture names and variants are normalized first, so
+// "linux/arm64" matches "linux/arm64/v8" and "linux/arm" matches
+// "linux/arm/v7". A required OS version matches any image OS version it is a
+// prefix of, so "windows/amd64:10.0.17763" matches "10.0.17763.2300".
+func MatchPlatform(required, p ocispec.Platform) bool {
+	if p.OS == "" || p.Architecture == "" {
+		return false
+	}
+	req, norm := platforms.Normalize(required), platforms.Normalize(p)
+	if req.OS != norm.OS || req.Architecture != norm.Architecture || req.Variant != norm.Variant {
+		return false
+	}
+	if required.OSVersion == "" {
+		return true
+	}
+	return p.OSVersion == required.OSVersion || strings.HasPrefix(p.OSVersion, required.OSVersion+".")
+}
+
+// MissingPlatforms returns the required platforms not satisfied by any of the
+// available platforms
+func MissingPlatforms(required, available []ocispec.Platform) []ocispec.Platform {
+	var missing []ocispec.Platform
+	for _, req := range required {
+		found := false
+		for _, p := range available {
+			if MatchPlatform(req, p) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, req)
+		}
+	}
+	return missing
+}
@@ -0,0 +1,95 @@
+package inspect
+
+import (
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		specifier string
+		want      ocispec.Platform
+		wantErr   bool
+	}{
+		{specifier: "linux/amd64", want: ocispec.Platform{OS: "linux", Architecture: "amd64"}},
+		{specifier: "linux/arm64/v8", want: ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		{specifier: "linux/arm/v7", want: ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}},
+		{specifier: "windows/amd64:10.0.17763", want: ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763"}},
+		{specifier: "linux", wantErr: true},
+		{specifier: "amd64", wantErr: true},
+		{specifier: "linux/not-an-arch!", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.specifier, func(t *testing.T) {
+			got, err := ParsePlatform(tt.specifier)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParsePlatform(%q) = %+v, want an error", tt.specifier, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.OS != tt.want.OS || got.Architecture != tt.want.Architecture || got.Variant != tt.want.Variant || got.OSVersion != tt.want.OSVersion {
+				t.Errorf("ParsePlatform(%q) = %+v, want %+v", tt.specifier, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchPlatform(t *testing.T) {
+	tests := []struct {
+		required string
+		image    ocispec.Platform
+		want     bool
+	}{
+		{"linux/amd64", ocispec.Platform{OS: "linux", Architecture: "amd64"}, true},
+		{"linux/amd64", ocispec.Platform{OS: "linux", Architecture: "arm64"}, false},
+		{"linux/amd64", ocispec.Platform{OS: "windows", Architecture: "amd64"}, false},
+		// arm64 defaults to v8, and arm to v7
+		{"linux/arm64", ocispec.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}, true},
+		{"linux/arm64/v8", ocispec.Platform{OS: "linux", Architecture: "arm64"}, true},
+		{"linux/arm", ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, true},
+		{"linux/arm/v7", ocispec.Platform{OS: "linux", Architecture: "arm"}, true},
+		{"linux/arm/v6", ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}, false},
+		// a required OS version matches image versions it is a prefix of
+		{"windows/amd64", ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.2300"}, true},
+		{"windows/amd64:10.0.17763", ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.2300"}, true},
+		{"windows/amd64:10.0.17763.2300", ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.2300"}, true},
+		{"windows/amd64:10.0.1776", ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.2300"}, false},
+		{"windows/amd64:10.0.20348", ocispec.Platform{OS: "windows", Architecture: "amd64", OSVersion: "10.0.17763.2300"}, false},
+		// attestation manifests have an unknown platform
+		{"linux/amd64", ocispec.Platform{OS: "unknown", Architecture: "unknown"}, false},
+		{"linux/amd64", ocispec.Platform{}, false},
+	}
+	for _, tt := range tests {
+		required, err := ParsePlatform(tt.required)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := MatchPlatform(required, tt.image); got != tt.want {
+			t.Errorf("MatchPlatform(%s, %+v) = %v, want %v", tt.required, tt.image, got, tt.want)
+		}
+	}
+}
+
+func TestMissingPlatforms(t *testing.T) {
+	available := []ocispec.Platform{
+		{OS: "linux", Architecture: "amd64"},
+		{OS: "linux", Architecture: "arm64", Variant: "v8"},
+	}
+	var required []ocispec.Platform
+	for _, spec := range []string{"linux/amd64", "linux/arm64", "linux/s390x"} {
+		p, err := ParsePlatform(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		required = append(required, p)
+	}
+	missing := MissingPlatforms(required, available)
+	if len(missing) != 1 || missing[0].Architecture != "s390x" {
+		t.Errorf("MissingPlatforms = %+v, want only linux/s390x", missing)
+	}
+}
@@ -0,0 +1,47 @@
+package inspect
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// RateLimit is a registry's pull rate limit status, as reported by Docker Hub
+// in the ratelimit-limit and ratelimit-remaining response headers
+type RateLimit struct {
+	// Limit is the number of requests allowed in each window
+	Limit int `json:"limit"`
+	// Remaining is the number of requests left in the current window
+	Remaining int `json:"remaining"`
+	// Window is the length of the window in seconds, if reported
+	Window int `json:"window,omitempty"`
+}
+
+// parseRateLimit returns the rate limit status in the response headers, or
+// nil if they don't include one. The header values have the form
+// "<count>;w=<seconds>".
+func parseRateLimit(header http.Header) *RateLimit {
+	limit, window, ok := parseRateLimitValue(header.Get("RateLimit-Limit"))
+	if !ok {
+		return nil
+	}
+	remaining, _, ok := parseRateLimitValue(header.Get("RateLimit-Remaining"))
+	if !ok {
+		return nil
+	}
+	return &RateLimit{Limit: limit, Remaining: remaining, Window: window}
+}
+
+func parseRateLimitValue(value string) (count, window int, ok bool) {
+	fields := strings.Split(value, ";")
+	count, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+	if err != nil {
+		return 0, 0, false
+	}
+	for _, field := range fields[1:] {
+		if w, found := strings.CutPrefix(strings.TrimSpace(field), "w="); found {
+			window, _ = strconv.Atoi(w)
+		}
+	}
+	return count, window, true
+}
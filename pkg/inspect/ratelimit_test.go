@@ -0,0 +1,37 @@
+package inspect
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		limit     string
+		remaining string
+		want      *RateLimit
+	}{
+		{"docker hub", "100;w=21600", "76;w=21600", &RateLimit{Limit: 100, Remaining: 76, Window: 21600}},
+		{"no window", "100", "0", &RateLimit{Limit: 100, Remaining: 0}},
+		{"spaces", "100; w=60", " 5 ; w=60", &RateLimit{Limit: 100, Remaining: 5, Window: 60}},
+		{"missing", "", "", nil},
+		{"no remaining", "100;w=21600", "", nil},
+		{"invalid", "lots", "76", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.limit != "" {
+				header.Set("RateLimit-Limit", tt.limit)
+			}
+			if tt.remaining != "" {
+				header.Set("RateLimit-Remaining", tt.remaining)
+			}
+			if got := parseRateLimit(header); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseRateLimit = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,325 @@
+package inspect
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/containerd/containerd/v2/core/remotes"
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	hostsconfig "github.com/containerd/containerd/v2/core/remotes/docker/config"
+	"github.com/containerd/errdefs"
+	"github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/credentials"
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// newResolver creates a resolver for the registry hosting imageRef. Unlike
+// util.CreateRegistryHost/util.GetResolver it keeps no package-level state, so
+// concurrent queries with different credentials are safe. If recorder is not
+// nil, it records the registry's responses to manifest requests.
+func newResolver(imageRef reference.Named, opts Options, recorder *responseRecorder) remotes.Resolver {
+	// containerd looks up the hosts for every resolve and fetch; configure
+	// them once so all the requests of a query share their clients, and so
+	// their retry state (see retryTransport)
+	hosts := sync.OnceValues(func() ([]docker.RegistryHost, error) {
+		hosts, err := registryHosts(imageRef, opts)
+		if err != nil || recorder == nil {
+			return hosts, err
+		}
+		for i := range hosts {
+			hosts[i].Client = recorder.wrap(hosts[i].Client)
+		}
+		return hosts, nil
+	})
+	return docker.NewResolver(docker.ResolverOptions{
+		Hosts: func(string) ([]docker.RegistryHost, error) {
+			return hosts()
+		},
+	})
+}
+
+// resolvedResolver answers Resolve for a reference that was already resolved
+// from the stored result, so fetching the manifest doesn't repeat the request
+type resolvedResolver struct {
+	remotes.Resolver
+	ref  string
+	name string
+	desc ocispec.Descriptor
+}
+
+func (r resolvedResolver) Resolve(ctx context.Context, ref string) (string, ocispec.Descriptor, error) {
+	if ref == r.ref {
+		return r.name, r.desc, nil
+	}
+	return r.Resolver.Resolve(ctx, ref)
+}
+
+// registryHosts returns the registry host configurations, including the
+// authorizer, for the registry hosting imageRef. Each host is tried in turn
+// until one responds: an insecure or local registry is tried over HTTPS and
+// then over plain HTTP. Failed requests that may succeed later are retried
+// (see retryTransport). If opts.HostsDir has a configuration for the registry,
+// its mirrors are tried before the upstream registry.
+func registryHosts(imageRef reference.Named, opts Options) ([]docker.RegistryHost, error) {
+	if opts.HostsDir != "" {
+		hosts, err := configuredHosts(reference.Domain(imageRef), opts)
+		if err == nil || !errdefs.IsNotFound(err) {
+			return hosts, err
+		}
+	}
+	hostname := registryHostname(reference.Domain(imageRef))
+	insecure := opts.Insecure || matchHost(opts.InsecureRegistries, hostname)
+	host := docker.RegistryHost{
+		Client:       retryClient(httpClient(insecure)),
+		Host:         hostname,
+		Scheme:       "https",
+		Path:         "/v2",
+		Capabilities: docker.HostCapabilityPull | docker.HostCapabilityResolve,
+	}
+	if useToken(opts, hostname) {
+		host.Authorizer = tokenAuthorizer{token: opts.Token, host: hostname}
+	} else {
+		host.Authorizer = docker.NewDockerAuthorizer(docker.WithAuthCreds(credentialsFunc(opts)), docker.WithAuthClient(host.Client))
+	}
+	if opts.PlainHTTP {
+		host.Scheme = "http"
+		return []docker.RegistryHost{host}, nil
+	}
+	if insecure || (opts.LocalPlainHTTP && isLocalHost(hostname)) {
+		plain := host
+		plain.Scheme = "http"
+		return []docker.RegistryHost{host, plain}, nil
+	}
+	return []docker.RegistryHost{host}, nil
+}
+
+// configuredHosts returns the hosts configured for the registry in the
+// containerd-style hosts directory opts.HostsDir (<dir>/<host>/hosts.toml, or
+// <dir>/_default/hosts.toml for all registries). Unless the configuration sets
+// a server, the upstream registry is tried after the mirrors. Insecure and
+// local hosts fall back to plain HTTP as in registryHosts. It returns a
+// NotFound error if the registry has no configuration.
+func configuredHosts(hostname string, opts Options) ([]docker.RegistryHost, error) {
+	dir, err := hostsconfig.HostDirFromRoot(opts.HostsDir)(hostname)
+	if err != nil {
+		return nil, err
+	}
+	insecure := opts.Insecure || matchHost(opts.InsecureRegistries, hostname)
+	hosts, err := hostsconfig.ConfigureHosts(context.Background(), hostsconfig.HostOptions{
+		HostDir: func(string) (string, error) {
+			return dir, nil
+		},
+		Credentials: credentialsFunc(opts),
+		UpdateClient: func(client *http.Client) error {
+			if transport, ok := client.Transport.(*http.Transport); ok && insecure {
+				transport.TLSClientConfig.InsecureSkipVerify = true
+			}
+			client.Transport = newRetryTransport(tracedTransport(client.Transport))
+			return nil
+		},
+	})(hostname)
+	if err != nil {
+		return nil, err
+	}
+	var result []docker.RegistryHost
+	for _, host := range hosts {
+		// mirrors never get the token; they authenticate with their own
+		// Docker config credentials, if any
+		if useToken(opts, host.Host) {
+			host.Authorizer = tokenAuthorizer{token: opts.Token, host: host.Host}
+		}
+		if opts.PlainHTTP {
+			host.Scheme = "http"
+		}
+		result = append(result, host)
+		// fall back to plain HTTP as for an unconfigured registry
+		if host.Scheme == "https" && (insecure || matchHost(opts.InsecureRegistries, host.Host) || (opts.LocalPlainHTTP && isLocalHost(host.Host))) {
+			plain := host
+			plain.Scheme = "http"
+			result = append(result, plain)
+		}
+	}
+	return result, nil
+}
+
+// responseRecorder records the first registry endpoint that successfully
+// served a manifest through the clients it wraps, and the latest rate limit
+// status reported with a manifest
+type responseRecorder struct {
+	mu        sync.Mutex
+	endpoint  string
+	rateLimit *RateLimit
+}
+
+// wrap returns a copy of client whose requests are recorded
+func (r *responseRecorder) wrap(client *http.Client) *http.Client {
+	c := *client
+	transport := c.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	c.Transport = recordingTransport{recorder: r, next: transport}
+	return &c
+}
+
+// Endpoint returns the scheme and host of the endpoint that served the
+// manifest, or "" if none has
+func (r *responseRecorder) Endpoint() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.endpoint
+}
+
+// RateLimit returns the rate limit status last reported by the registry, or
+// nil if it doesn't report one
+func (r *responseRecorder) RateLimit() *RateLimit {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rateLimit
+}
+
+func (r *responseRecorder) record(resp *http.Response) {
+	if resp.Request == nil || !strings.Contains(resp.Request.URL.Path, "/manifests/") {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if rl := parseRateLimit(resp.Header); rl != nil {
+		r.rateLimit = rl
+	}
+	if r.endpoint == "" && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		r.endpoint = resp.Request.URL.Scheme + "://" + resp.Request.URL.Host
+	}
+}
+
+type recordingTransport struct {
+	recorder *responseRecorder
+	next     http.RoundTripper
+}
+
+func (t recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err == nil {
+		t.recorder.record(resp)
+	}
+	return resp, err
+}
+
+// httpClient returns the client for registry requests; an insecure client
+// doesn't verify the registry's TLS certificate
+func httpClient(insecure bool) *http.Client {
+	if !insecure {
+		return http.DefaultClient
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	return &http.Client{Transport: transport}
+}
+
+// matchHost reports whether hostname (which may include a port) is in the
+// list of hosts; a list entry without a port matches any port
+func matchHost(hosts []string, hostname string) bool {
+	name := hostname
+	if h, _, err := net.SplitHostPort(hostname); err == nil {
+		name = h
+	}
+	for _, h := range hosts {
+		if h == hostname || h == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalHost reports whether the registry host is localhost or a loopback
+// address
+func isLocalHost(hostname string) bool {
+	if h, _, err := net.SplitHostPort(hostname); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" || strings.HasSuffix(hostname, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(strings.Trim(hostname, "[]"))
+	return ip != nil && ip.IsLoopback()
+}
+
+// useToken reports whether opts.Token belongs to the registry served by
+// hostname
+func useToken(opts Options, hostname string) bool {
+	return opts.Token != "" && isCredentialsHost(opts, hostname)
+}
+
+// isCredentialsHost reports whether hostname serves opts.Registry, the
+// registry the explicit credentials belong to
+func isCredentialsHost(opts Options, hostname string) bool {
+	return opts.Registry != "" && strings.EqualFold(registryHostname(opts.Registry), hostname)
+}
+
+// credentialsFunc returns the explicitly provided username and password for
+// the registry they belong to (opts.Registry), otherwise it looks up
+// credentials for the registry in the Docker config file (including any
+// configured credential helpers) unless opts.IgnoreDockerConfig is set
+func credentialsFunc(opts Options) func(string) (string, string, error) {
+	return func(hostName string) (string, string, error) {
+		if (opts.Username != "" || opts.Password != "") && isCredentialsHost(opts, hostName) {
+			return opts.Username, opts.Password, nil
+		}
+		if opts.IgnoreDockerConfig {
+			return "", "", nil
+		}
+		cfg, err := loadDockerConfig(opts.DockerConfig)
+		if err != nil {
+			return "", "", err
+		}
+		if !cfg.ContainsAuth() {
+			cfg.CredentialsStore = credentials.DetectDefaultStore(cfg.CredentialsStore)
+		}
+		if strings.HasSuffix(hostName, util.DefaultHostname) {
+			// Docker's `config.json` uses index.docker.io as the reference
+			hostName = util.LegacyDefaultHostname
+		}
+		auth, err := cfg.GetAuthConfig(hostName)
+		if err != nil {
+			return "", "", err
+		}
+		if auth.IdentityToken != "" {
+			return "", auth.IdentityToken, nil
+		}
+		return auth.Username, auth.Password, nil
+	}
+}
+
+// loadDockerConfig loads the Docker client configuration from dir, or from
+// the default location ($DOCKER_CONFIG or ~/.docker) when dir is empty
+func loadDockerConfig(dir string) (*configfile.ConfigFile, error) {
+	if dir == "" {
+		dir = config.Dir()
+	}
+	return config.Load(dir)
+}
+
+// tokenAuthorizer presents a caller-supplied bearer token to the registry
+// host it belongs to; it never attempts to negotiate a token of its own
+type tokenAuthorizer struct {
+	token string
+	host  string
+}
+
+func (t tokenAuthorizer) Authorize(ctx context.Context, req *http.Request) error {
+	if strings.EqualFold(req.URL.Host, t.host) {
+		req.Header.Set("Authorization", "Bearer "+t.token)
+	}
+	return nil
+}
+
+func (t tokenAuthorizer) AddResponses(ctx context.Context, responses []*http.Response) error {
+	return errdefs.ErrNotImplemented
+}
@@ -0,0 +1,128 @@
+package inspect
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCredentialsFunc(t *testing.T) {
+	tests := []struct {
+		name     string
+		registry string
+		host     string
+		wantUser string
+	}{
+		{"matching registry", "registry.example.com", "registry.example.com", "user"},
+		{"other registry", "registry.example.com", "mirror.example.com", ""},
+		{"docker hub", "docker.io", "registry-1.docker.io", "user"},
+		{"unbound", "", "registry.example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := Options{
+				Username:     "user",
+				Password:     "secret",
+				Registry:     tt.registry,
+				DockerConfig: t.TempDir(),
+			}
+			user, _, err := credentialsFunc(opts)(tt.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user != tt.wantUser {
+				t.Errorf("username for %s = %q, want %q", tt.host, user, tt.wantUser)
+			}
+		})
+	}
+}
+
+func TestCredentialsFuncDockerConfig(t *testing.T) {
+	dir := t.TempDir()
+	// "dXNlcjpzZWNyZXQ=" is base64 for "user:secret"
+	config := `{"auths": {"registry.example.com": {"auth": "dXNlcjpzZWNyZXQ="}}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, ignore := range []bool{false, true} {
+		opts := Options{DockerConfig: dir, IgnoreDockerConfig: ignore}
+		user, _, err := credentialsFunc(opts)("registry.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "user"
+		if ignore {
+			want = ""
+		}
+		if user != want {
+			t.Errorf("username with IgnoreDockerConfig=%v = %q, want %q", ignore, user, want)
+		}
+	}
+}
+
+func TestTokenAuthorizer(t *testing.T) {
+	auth := tokenAuthorizer{token: "abc", host: "registry.example.com"}
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://registry.example.com/v2/app/manifests/1.0", "Bearer abc"},
+		{"https://mirror.example.com/v2/app/manifests/1.0", ""},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(http.MethodGet, tt.url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := auth.Authorize(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get("Authorization"); got != tt.want {
+			t.Errorf("Authorization for %s = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestConfiguredHostsPlainHTTP(t *testing.T) {
+	dir := t.TempDir()
+	config := `server = "https://registry.example.com"
+
+[host."https://mirror.example.com"]
+  capabilities = ["pull", "resolve"]
+`
+	if err := os.MkdirAll(filepath.Join(dir, "registry.example.com"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "registry.example.com", "hosts.toml"), []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"secure", Options{}, []string{"https://mirror.example.com", "https://registry.example.com"}},
+		{"insecure", Options{Insecure: true}, []string{"https://mirror.example.com", "http://mirror.example.com", "https://registry.example.com", "http://registry.example.com"}},
+		{"insecure mirror", Options{InsecureRegistries: []string{"mirror.example.com"}}, []string{"https://mirror.example.com", "http://mirror.example.com", "https://registry.example.com"}},
+		{"plain http", Options{PlainHTTP: true}, []string{"http://mirror.example.com", "http://registry.example.com"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.HostsDir = dir
+			hosts, err := configuredHosts("registry.example.com", tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, host := range hosts {
+				got = append(got, host.Scheme+"://"+host.Host)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("configuredHosts = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
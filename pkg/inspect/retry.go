@@ -0,0 +1,141 @@
+package inspect
+
+import (
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxRetries is the number of times a failed registry request is retried
+	maxRetries = 3
+	// retryBaseDelay is the backoff before the first retry; it doubles for
+	// each further retry
+	retryBaseDelay = 500 * time.Millisecond
+	// maxRetryAfter is the longest Retry-After delay that is waited for;
+	// a registry asking for a longer wait gets the failure reported instead
+	maxRetryAfter = 30 * time.Second
+)
+
+// retryClient returns a copy of client that retries failed requests,
+// recording a span for each attempt
+func retryClient(client *http.Client) *http.Client {
+	c := *client
+	c.Transport = newRetryTransport(tracedTransport(c.Transport))
+	return &c
+}
+
+// retryTransport retries requests that fail with a server error, a 429 Too
+// Many Requests response or a dropped connection. It waits for the
+// Retry-After delay if the registry sends one, or else backs off
+// exponentially with jitter, and gives up early if the request's context is
+// done. Once a request has used up its retries, later requests through the
+// transport aren't retried: containerd repeats some failed requests itself,
+// and the registry is unlikely to recover within the query. The transport is
+// created when a query's registry hosts are configured, once per query (see
+// newResolver and listTags), so this never outlasts the query, but it covers
+// every host sharing the transport's client: the HTTPS and plain HTTP
+// endpoints of a registry, and mirrors without their own TLS settings.
+type retryTransport struct {
+	next   http.RoundTripper
+	gaveUp *atomic.Bool
+}
+
+func newRetryTransport(next http.RoundTripper) retryTransport {
+	return retryTransport{next: next, gaveUp: &atomic.Bool{}}
+}
+
+func (t retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	next := t.next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err := next.RoundTrip(req)
+		if t.gaveUp.Load() || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+		delay, ok := retryDelay(resp, err, attempt)
+		if !ok {
+			return resp, err
+		}
+		if attempt == maxRetries {
+			t.gaveUp.Store(true)
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req = req.Clone(req.Context())
+			req.Body = body
+		}
+	}
+}
+
+// retryDelay returns how long to wait before retrying a request that got
+// resp or err, and whether it should be retried at all
+func retryDelay(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if err != nil {
+		return backoff(attempt), isConnectionReset(err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+	case resp.StatusCode >= 500 && resp.StatusCode != http.StatusNotImplemented:
+	default:
+		return 0, false
+	}
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		delay, ok := parseRetryAfter(v)
+		return delay, ok && delay <= maxRetryAfter
+	}
+	return backoff(attempt), true
+}
+
+// backoff returns the delay before retry attempt+1: half of the exponential
+// delay plus a random jitter of up to the other half
+func backoff(attempt int) time.Duration {
+	delay := retryBaseDelay << attempt
+	return delay/2 + rand.N(delay/2)
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// isConnectionReset reports whether the registry dropped the connection.
+// Any failure to read or write an established connection counts, rather than
+// just ECONNRESET, whose value differs between platforms (WSAECONNRESET on
+// Windows); failures to connect are left to the resolver, which tries the
+// next host.
+func isConnectionReset(err error) bool {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && (opErr.Op == "read" || opErr.Op == "write") {
+		return true
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
@@ -0,0 +1,220 @@
+package inspect
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"0", 0, true},
+		{"5", 5 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		// a date in the past means retry now
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	date := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	got, ok := parseRetryAfter(date)
+	if !ok || got <= 58*time.Second || got > time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %v, %v; want about a minute", date, got, ok)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		err        error
+		wantRetry  bool
+		// wantDelay is checked if set; otherwise the delay must be a
+		// backoff for the first attempt
+		wantDelay time.Duration
+	}{
+		{name: "ok", status: http.StatusOK},
+		{name: "not found", status: http.StatusNotFound},
+		{name: "unauthorized", status: http.StatusUnauthorized},
+		{name: "not implemented", status: http.StatusNotImplemented},
+		{name: "server error", status: http.StatusInternalServerError, wantRetry: true},
+		{name: "bad gateway", status: http.StatusBadGateway, wantRetry: true},
+		{name: "unavailable", status: http.StatusServiceUnavailable, wantRetry: true},
+		{name: "rate limited", status: http.StatusTooManyRequests, wantRetry: true},
+		{name: "retry after", status: http.StatusTooManyRequests, retryAfter: "2", wantRetry: true, wantDelay: 2 * time.Second},
+		{name: "retry after too long", status: http.StatusTooManyRequests, retryAfter: "3600"},
+		{name: "connection reset", err: &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, wantRetry: true},
+		{name: "broken pipe", err: &net.OpError{Op: "write", Net: "tcp", Err: syscall.EPIPE}, wantRetry: true},
+		{name: "closed connection", err: io.ErrUnexpectedEOF, wantRetry: true},
+		{name: "connection refused", err: &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}},
+		{name: "cancelled", err: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var resp *http.Response
+			if tt.err == nil {
+				resp = &http.Response{StatusCode: tt.status, Header: http.Header{}}
+				if tt.retryAfter != "" {
+					resp.Header.Set("Retry-After", tt.retryAfter)
+				}
+			}
+			delay, retry := retryDelay(resp, tt.err, 0)
+			if retry != tt.wantRetry {
+				t.Fatalf("retryDelay retry = %v, want %v", retry, tt.wantRetry)
+			}
+			if !retry {
+				return
+			}
+			if tt.wantDelay != 0 {
+				if delay != tt.wantDelay {
+					t.Errorf("retryDelay delay = %v, want %v", delay, tt.wantDelay)
+				}
+			} else if delay < retryBaseDelay/2 || delay >= retryBaseDelay {
+				t.Errorf("retryDelay delay = %v, want a backoff between %v and %v", delay, retryBaseDelay/2, retryBaseDelay)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		delay := retryBaseDelay << attempt
+		if got := backoff(attempt); got < delay/2 || got >= delay {
+			t.Errorf("backoff(%d) = %v, want between %v and %v", attempt, got, delay/2, delay)
+		}
+	}
+}
+
+// failingServer responds with status to the first failures requests, each
+// asking for an immediate retry, and then with 200 OK
+func failingServer(t *testing.T, status, failures int) (string, *atomic.Int32) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(requests.Add(1)) <= failures {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL, &requests
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		failures     int
+		wantStatus   int
+		wantRequests int
+	}{
+		{"success", http.StatusOK, 0, http.StatusOK, 1},
+		{"unavailable once", http.StatusServiceUnavailable, 1, http.StatusOK, 2},
+		{"rate limited twice", http.StatusTooManyRequests, 2, http.StatusOK, 3},
+		{"unavailable", http.StatusServiceUnavailable, 10, http.StatusServiceUnavailable, maxRetries + 1},
+		{"not found", http.StatusNotFound, 10, http.StatusNotFound, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			url, requests := failingServer(t, tt.status, tt.failures)
+			client := &http.Client{Transport: newRetryTransport(http.DefaultTransport)}
+			resp, err := client.Get(url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if got := int(requests.Load()); got != tt.wantRequests {
+				t.Errorf("registry got %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestRetryTransportGivesUp(t *testing.T) {
+	url, requests := failingServer(t, http.StatusServiceUnavailable, 100)
+	client := &http.Client{Transport: newRetryTransport(http.DefaultTransport)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	// once the first request used up its retries, the second isn't retried
+	if got := int(requests.Load()); got != maxRetries+2 {
+		t.Errorf("registry got %d requests, want %d", got, maxRetries+2)
+	}
+}
+
+func TestRetryTransportCancel(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Retry-After", strconv.Itoa(int(maxRetryAfter/time.Second)))
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(server.Close)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = newRetryTransport(http.DefaultTransport).RoundTrip(req)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RoundTrip = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("registry got %d requests, want 1", got)
+	}
+}
+
+func TestRetryTransportConnectionReset(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// drop the connection without a response
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+	// a fresh connection for each request, so the dropped connection isn't
+	// retried by net/http itself
+	transport := &http.Transport{DisableKeepAlives: true}
+	resp, err := (&http.Client{Transport: newRetryTransport(transport)}).Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || requests.Load() != 2 {
+		t.Errorf("got status %d after %d requests, want 200 after 2", resp.StatusCode, requests.Load())
+	}
+}
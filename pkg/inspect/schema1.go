@@ -0,0 +1,71 @@
+package inspect
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/containerd/containerd/v2/core/remotes"
+	"github.com/docker/distribution/reference"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// mediaTypeDockerSchema1UnsignedManifest is the unsigned variant of the
+// legacy Docker schema1 manifest
+const mediaTypeDockerSchema1UnsignedManifest = "application/vnd.docker.distribution.manifest.v1+json"
+
+// maxSchema1Size limits the size of a schema1 manifest read from a registry
+const maxSchema1Size = 4 << 20
+
+// schema1Manifest holds the fields of a Docker schema1 manifest that carry
+// platform information
+type schema1Manifest struct {
+	Architecture string `json:"architecture"`
+	History      []struct {
+		V1Compatibility string `json:"v1Compatibility"`
+	} `json:"history"`
+}
+
+// isSchema1 reports whether mediaType is a signed or unsigned Docker schema1
+// manifest
+func isSchema1(mediaType string) bool {
+	return mediaType == images.MediaTypeDockerSchema1Manifest || mediaType == mediaTypeDockerSchema1UnsignedManifest
+}
+
+// schema1Image reports the platform of a legacy schema1 image. Schema1 images
+// are always single-platform; the architecture is recorded in the manifest
+// and the OS in the v1 compatibility config of the top layer.
+func schema1Image(ctx context.Context, resolver remotes.Resolver, imageRef reference.Named, desc ocispec.Descriptor) (*Image, error) {
+	fetcher, err := resolver.Fetcher(ctx, imageRef.String())
+	if err != nil {
+		return nil, err
+	}
+	// the fetcher only uses the manifests endpoint for the signed media type
+	fetchDesc := desc
+	fetchDesc.MediaType = images.MediaTypeDockerSchema1Manifest
+	rc, err := fetcher.Fetch(ctx, fetchDesc)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(io.LimitReader(rc, maxSchema1Size))
+	if err != nil {
+		return nil, err
+	}
+	var man schema1Manifest
+	if err := json.Unmarshal(b, &man); err != nil {
+		return nil, err
+	}
+	platform := ocispec.Platform{OS: "linux", Architecture: man.Architecture}
+	if len(man.History) > 0 {
+		var v1 struct {
+			OS string `json:"os"`
+		}
+		if err := json.Unmarshal([]byte(man.History[0].V1Compatibility), &v1); err == nil && v1.OS != "" {
+			platform.OS = v1.OS
+		}
+	}
+	image := generateImage(imageRef.String(), nil, desc, ocispec.Index{}, ocispec.Image{Platform: platform})
+	return image, nil
+}
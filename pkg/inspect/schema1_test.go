@@ -0,0 +1,92 @@
+package inspect
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/images"
+	"github.com/opencontainers/go-digest"
+)
+
+// schema1Registry serves a signed schema1 manifest for the "signed" tag and
+// an unsigned one for "unsigned"
+func schema1Registry(t *testing.T) string {
+	manifests := map[string]struct {
+		mediaType string
+		body      string
+	}{
+		"signed": {images.MediaTypeDockerSchema1Manifest, `{
+  "schemaVersion": 1,
+  "name": "app",
+  "tag": "signed",
+  "architecture": "arm64",
+  "history": [{"v1Compatibility": "{\"os\":\"linux\",\"architecture\":\"arm64\"}"}],
+  "signatures": [{"header": {"alg": "ES256"}, "signature": "c2lnbmF0dXJl", "protected": "cHJvdGVjdGVk"}]
+}`},
+		"unsigned": {mediaTypeDockerSchema1UnsignedManifest, `{
+  "schemaVersion": 1,
+  "name": "app",
+  "tag": "unsigned",
+  "architecture": "amd64",
+  "history": [{"v1Compatibility": "{\"os\":\"windows\",\"architecture\":\"amd64\"}"}]
+}`},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag, found := strings.CutPrefix(r.URL.Path, "/v2/app/manifests/")
+		if r.URL.Path == "/v2/" {
+			return
+		}
+		// the fetcher requests the manifest by digest
+		for name, m := range manifests {
+			if tag == digest.FromString(m.body).String() {
+				tag = name
+			}
+		}
+		m, ok := manifests[tag]
+		if !found || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", m.mediaType)
+		w.Header().Set("Docker-Content-Digest", digest.FromString(m.body).String())
+		w.Header().Set("Content-Length", strconv.Itoa(len(m.body)))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write([]byte(m.body))
+		}
+	}))
+	t.Cleanup(server.Close)
+	return strings.TrimPrefix(server.URL, "http://")
+}
+
+func TestQueryRegistrySchema1(t *testing.T) {
+	host := schema1Registry(t)
+	tests := []struct {
+		tag       string
+		mediaType string
+		platform  string
+	}{
+		{"signed", images.MediaTypeDockerSchema1Manifest, "linux/arm64"},
+		{"unsigned", mediaTypeDockerSchema1UnsignedManifest, "windows/amd64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tag, func(t *testing.T) {
+			image, err := QueryRegistry(context.Background(), host+"/app:"+tt.tag, Options{PlainHTTP: true, IgnoreDockerConfig: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if image.MediaType != tt.mediaType {
+				t.Errorf("media type = %s, want %s", image.MediaType, tt.mediaType)
+			}
+			if image.IsList || len(image.ArchList) != 1 {
+				t.Fatalf("platforms = %+v, want only %s", image.ArchList, tt.platform)
+			}
+			if got := image.ArchList[0].OS + "/" + image.ArchList[0].Architecture; got != tt.platform {
+				t.Errorf("platform = %s, want %s", got, tt.platform)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package inspect
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	remoteerrors "github.com/containerd/containerd/v2/core/remotes/errors"
+	"github.com/containerd/errdefs"
+	"github.com/docker/distribution/reference"
+	"github.com/estesp/manifest-tool/v2/pkg/util"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxTagPages bounds the number of paginated tags list requests for a
+// single repository
+const maxTagPages = 100
+
+// Tags lists the tags of a repository
+type Tags struct {
+	// Repository is the canonical repository name
+	Repository string   `json:"repository"`
+	Tags       []string `json:"tags"`
+	// Truncated is set when the registry had more pages of tags than are
+	// fetched (maxTagPages), so Tags is incomplete
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ListTags returns the tags of the named repository using the registry's
+// /v2/<name>/tags/list API, following paginated responses. Any tag or digest
+// in name is ignored.
+func ListTags(ctx context.Context, name string, opts Options) (tags *Tags, err error) {
+	ctx, span := tracer.Start(ctx, "inspect.ListTags", trace.WithAttributes(attribute.String("mquery.repository", name)))
+	defer func() { endSpan(span, err) }()
+	tags, err = listTags(ctx, name, opts)
+	if err != nil {
+		return nil, classify(ctx, err)
+	}
+	return tags, nil
+}
+
+func listTags(ctx context.Context, name string, opts Options) (*Tags, error) {
+	var lastErr error
+	ref, err := util.ParseName(name)
+	if err != nil {
+		return nil, &Error{Code: CodeInvalidName, Err: err}
+	}
+	repo := reference.TrimNamed(ref)
+	ctx = docker.WithScope(ctx, fmt.Sprintf("repository:%s:pull", reference.Path(repo)))
+	hosts, err := registryHosts(repo, opts)
+	if err != nil {
+		return nil, err
+	}
+	// like the resolver, try each host until one responds; a mirror may
+	// also not have the repository
+	for _, host := range hosts {
+		tags, err := listHostTags(ctx, host, repo)
+		if err == nil || !(isConnectionError(err) || errdefs.IsNotFound(err)) {
+			return tags, err
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no registry hosts configured for %s: %w", reference.Domain(repo), errdefs.ErrNotFound)
+	}
+	return nil, lastErr
+}
+
+func listHostTags(ctx context.Context, host docker.RegistryHost, repo reference.Named) (*Tags, error) {
+	result := &Tags{Repository: repo.String(), Tags: []string{}}
+	next := &url.URL{
+		Scheme: host.Scheme,
+		Host:   host.Host,
+		Path:   fmt.Sprintf("%s/%s/tags/list", host.Path, reference.Path(repo)),
+	}
+	for page := 0; next != nil && page < maxTagPages; page++ {
+		resp, err := authorizedGet(ctx, host, next.String())
+		if err != nil {
+			return nil, err
+		}
+		var body struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid tags list response: %w", err)
+		}
+		result.Tags = append(result.Tags, body.Tags...)
+		next, err = nextPage(resp)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result.Truncated = next != nil
+	return result, nil
+}
+
+// isConnectionError reports whether err is a failure to connect to the
+// registry or a protocol mismatch, rather than an error response
+func isConnectionError(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// authorizedGet sends a GET request to the registry host, retrying once with
+// credentials if the registry responds with an authentication challenge
+func authorizedGet(ctx context.Context, host docker.RegistryHost, u string) (*http.Response, error) {
+	var resp *http.Response
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if err := host.Authorizer.Authorize(ctx, req); err != nil {
+			return nil, err
+		}
+		resp, err = host.Client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			break
+		}
+		err = host.Authorizer.AddResponses(ctx, []*http.Response{resp})
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			// no way to authenticate; report the original challenge
+			return nil, remoteerrors.ErrUnexpectedStatus{Status: resp.Status, StatusCode: resp.StatusCode, RequestURL: u, RequestMethod: http.MethodGet}
+		}
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("repository %s: %w", u, errdefs.ErrNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, remoteerrors.NewUnexpectedStatusErr(resp)
+	}
+	return resp, nil
+}
+
+// nextPage returns the URL of the next page of results given in the Link
+// header, if any
+func nextPage(resp *http.Response) (*url.URL, error) {
+	link := resp.Header.Get("Link")
+	if link == "" {
+		return nil, nil
+	}
+	// the header has the form `</v2/name/tags/list?n=100&last=tag>; rel="next"`
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start || !strings.Contains(link[end:], `rel="next"`) {
+		return nil, nil
+	}
+	next, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return nil, fmt.Errorf("invalid Link header %q: %w", link, err)
+	}
+	return resp.Request.URL.ResolveReference(next), nil
+}
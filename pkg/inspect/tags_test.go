@@ -0,0 +1,110 @@
+package inspect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/containerd/containerd/v2/core/remotes/docker"
+	"github.com/docker/distribution/reference"
+)
+
+func TestNextPage(t *testing.T) {
+	tests := []struct {
+		link    string
+		want    string
+		wantErr bool
+	}{
+		{link: "", want: ""},
+		{link: `</v2/app/tags/list?n=100&last=v1.2>; rel="next"`, want: "https://registry.example.com/v2/app/tags/list?n=100&last=v1.2"},
+		{link: `<https://cdn.example.com/v2/app/tags/list?last=v1.2>; rel="next"`, want: "https://cdn.example.com/v2/app/tags/list?last=v1.2"},
+		{link: `</v2/app/tags/list?n=100&last=v1.2>; rel="prev"`, want: ""},
+		{link: `rel="next"`, want: ""},
+		{link: `<%zz>; rel="next"`, wantErr: true},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{
+			Header:  http.Header{},
+			Request: &http.Request{URL: &url.URL{Scheme: "https", Host: "registry.example.com", Path: "/v2/app/tags/list"}},
+		}
+		if tt.link != "" {
+			resp.Header.Set("Link", tt.link)
+		}
+		next, err := nextPage(resp)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("nextPage(%q) = %v, want an error", tt.link, next)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("nextPage(%q): %v", tt.link, err)
+			continue
+		}
+		got := ""
+		if next != nil {
+			got = next.String()
+		}
+		if got != tt.want {
+			t.Errorf("nextPage(%q) = %q, want %q", tt.link, got, tt.want)
+		}
+	}
+}
+
+// tagsRegistry serves pages of two tags each, with pages in total or an
+// endless list if pages is 0
+func tagsRegistry(t *testing.T, pages int) docker.RegistryHost {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("last"))
+		if pages == 0 || page+1 < pages {
+			w.Header().Set("Link", fmt.Sprintf(`<%s?last=%d>; rel="next"`, r.URL.Path, page+1))
+		}
+		fmt.Fprintf(w, `{"tags": ["%d-a", "%d-b"]}`, page, page)
+	}))
+	t.Cleanup(server.Close)
+	return docker.RegistryHost{
+		Client:     server.Client(),
+		Authorizer: tokenAuthorizer{},
+		Host:       strings.TrimPrefix(server.URL, "http://"),
+		Scheme:     "http",
+		Path:       "/v2",
+	}
+}
+
+func TestListHostTags(t *testing.T) {
+	tests := []struct {
+		name          string
+		pages         int
+		wantTags      int
+		wantTruncated bool
+	}{
+		{"one page", 1, 2, false},
+		{"several pages", 3, 6, false},
+		{"all pages", maxTagPages, 2 * maxTagPages, false},
+		{"too many pages", 0, 2 * maxTagPages, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := tagsRegistry(t, tt.pages)
+			repo, err := reference.ParseNormalizedNamed(host.Host + "/app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tags, err := listHostTags(context.Background(), host, repo)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tags.Tags) != tt.wantTags || tags.Truncated != tt.wantTruncated {
+				t.Errorf("listHostTags returned %d tags, truncated %v; want %d tags, truncated %v", len(tags.Tags), tags.Truncated, tt.wantTags, tt.wantTruncated)
+			}
+			if tags.Tags[0] != "0-a" {
+				t.Errorf("first tag = %q, want 0-a", tags.Tags[0])
+			}
+		})
+	}
+}
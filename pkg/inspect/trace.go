@@ -0,0 +1,38 @@
+package inspect
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records the spans of registry queries; it is a no-op unless the
+// program installs a tracer provider
+var tracer = otel.Tracer("github.com/estesp/mquery/pkg/inspect")
+
+// endSpan ends span, marking it as failed if err is not nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracedTransport records a span for each registry round-trip. The trace
+// context isn't propagated: registries are third-party services.
+func tracedTransport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return otelhttp.NewTransport(next,
+		otelhttp.WithPropagators(propagation.NewCompositeTextMapPropagator()),
+		otelhttp.WithSpanNameFormatter(func(_ string, req *http.Request) string {
+			return "registry " + req.Method
+		}),
+	)
+}
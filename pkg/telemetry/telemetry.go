@@ -0,0 +1,78 @@
+// Package telemetry configures OpenTelemetry tracing for the mquery CLI and
+// backend from the standard OTEL_* environment variables
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// supported values of OTEL_TRACES_EXPORTER
+const (
+	exporterOTLP    = "otlp"
+	exporterConsole = "console"
+	exporterStdout  = "stdout"
+	exporterNone    = "none"
+)
+
+// Setup installs the W3C trace context propagator and, if an exporter is
+// configured, a tracer provider exporting the spans of the named service.
+// Spans are sent to an OTLP/HTTP collector when OTEL_TRACES_EXPORTER is
+// "otlp" or an OTEL_EXPORTER_OTLP_ENDPOINT is set, or written to stderr
+// when OTEL_TRACES_EXPORTER is "console" or "stdout". The returned function
+// flushes any remaining spans and must be called before exiting.
+func Setup(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporter, err := newExporter(ctx)
+	if err != nil || exporter == nil {
+		return func(context.Context) error { return nil }, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+func newExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	switch name := os.Getenv("OTEL_TRACES_EXPORTER"); name {
+	case exporterOTLP:
+		return otlptracehttp.New(ctx)
+	case exporterConsole, exporterStdout:
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stderr), stdouttrace.WithPrettyPrint())
+	case exporterNone:
+		return nil, nil
+	case "":
+		if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+			return otlptracehttp.New(ctx)
+		}
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported OTEL_TRACES_EXPORTER %q (use otlp, console or none)", name)
+	}
+}
+
+// Flush exports the spans recorded so far. A Lambda function is frozen
+// between invocations, so it must flush before returning each response.
+func Flush(ctx context.Context) error {
+	if provider, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		return provider.ForceFlush(ctx)
+	}
+	return nil
+}
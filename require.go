@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/estesp/mquery/pkg/inspect"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// platformList collects the comma-separated platforms given with --require
+type platformList []ocispec.Platform
+
+func (p *platformList) String() string {
+	var strs []string
+	for _, platform := range *p {
+		strs = append(strs, parsePlatform(platform))
+	}
+	return strings.Join(strs, ",")
+}
+
+func (p *platformList) Set(value string) error {
+	for _, spec := range strings.Split(value, ",") {
+		if spec = strings.TrimSpace(spec); spec == "" {
+			continue
+		}
+		platform, err := inspect.ParsePlatform(spec)
+		if err != nil {
+			return err
+		}
+		*p = append(*p, platform)
+	}
+	return nil
+}
+
+var required platformList
+
+// checkRequired reports any required platforms the image does not support.
+// The report goes to stderr so it doesn't interfere with machine-readable
+// output on stdout.
+func checkRequired(imageName string, image *Image) bool {
+	if len(required) == 0 {
+		return true
+	}
+	missing := inspect.MissingPlatforms(required, image.ArchList)
+	if len(missing) == 0 {
+		return true
+	}
+	var strs []string
+	for _, platform := range missing {
+		strs = append(strs, parsePlatform(platform))
+	}
+	fmt.Fprintf(os.Stderr, "MISSING: %s does not support required platforms: %s\n", imageName, strings.Join(strs, ", "))
+	return false
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestPlatformListSet(t *testing.T) {
+	tests := []struct {
+		values  []string
+		want    string
+		wantErr bool
+	}{
+		{values: []string{"linux/amd64"}, want: "linux/amd64"},
+		{values: []string{"linux/amd64, linux/arm64/v8"}, want: "linux/amd64,linux/arm64/v8"},
+		{values: []string{"linux/amd64", "windows/amd64:10.0.17763"}, want: "linux/amd64,windows/amd64:10.0.17763"},
+		{values: []string{"linux/arm/v7,,"}, want: "linux/arm/v7"},
+		{values: []string{"linux/amd64,arm64"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		var list platformList
+		var err error
+		for _, value := range tt.values {
+			if err = list.Set(value); err != nil {
+				break
+			}
+		}
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("Set(%q) = %s, want an error", tt.values, list.String())
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Set(%q): %v", tt.values, err)
+		}
+		if got := list.String(); got != tt.want {
+			t.Errorf("Set(%q) = %s, want %s", tt.values, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Masterminds/semver"
+	"github.com/estesp/mquery/pkg/inspect"
+)
+
+var (
+	tagPattern  = flag.String("tag-filter", "", "only report tags matching this regular expression (tags command)")
+	semverRange = flag.String("semver", "", "only report tags that are semantic versions within this range, e.g. '>=1.2, <2' (tags command)")
+)
+
+// tagsCommand lists the tags of a repository and reports the platforms
+// supported by each tag
+func tagsCommand(args []string) int {
+	if err := parseSubcommand(args, "tags REPOSITORY", 1); err != nil {
+		printError("%v\n", err)
+		return exitError
+	}
+	if err := validateOutput(); err != nil {
+		printError("%v\n", err)
+		return exitError
+	}
+	filter, err := newTagFilter(*tagPattern, *semverRange)
+	if err != nil {
+		printError("%v\n", err)
+		return exitError
+	}
+	repo, code, err := listTags(args[0])
+	if err != nil {
+		return reportError(args[0], code, err.Error())
+	}
+	if repo.Truncated {
+		fmt.Fprintf(os.Stderr, "WARNING: %s has too many tags to list them all; only the first %d were returned\n", repo.Repository, len(repo.Tags))
+	}
+	tags := filter.apply(repo.Tags)
+	if len(tags) == 0 {
+		fmt.Printf("No matching tags found in %s\n", repo.Repository)
+		return exitOK
+	}
+	names := make([]string, len(tags))
+	for i, tag := range tags {
+		names[i] = repo.Repository + ":" + tag
+	}
+	results, rc, err := queryResults(names)
+	if err != nil {
+		printError("%v\n", err)
+		return rc
+	}
+	if structuredOutput() {
+		return outputResults(results)
+	}
+	printTagTable(repo.Repository, tags, results)
+	printResultErrors(results)
+	return resultsExitCode(results)
+}
+
+// listTags lists the repository's tags directly or through the backend
+func listTags(name string) (*inspect.Tags, inspect.ErrorCode, error) {
+	if *direct {
+		ctx, cancel := queryContext()
+		defer cancel()
+		tags, err := inspect.ListTags(ctx, name, directOptions(name))
+		return tags, inspect.Code(err), err
+	}
+	cfg, err := loadConfig(*configPath)
+	if err != nil {
+		return nil, inspect.CodeInternal, fmt.Errorf("failed to load config: %w", err)
+	}
+	client := newBackendClient(resolveEndpoint(*endpoint, cfg), cfg, []string{name})
+	tags := new(inspect.Tags)
+	errResp := new(ErrorResponse)
+	resp, err := client.QueryStruct(&QueryParams{Repository: name, Timeout: timeoutSeconds()}).Receive(tags, errResp)
+	if err != nil {
+		if isTimeout(err) {
+			return nil, inspect.CodeTimeout, fmt.Errorf("timed out waiting for the backend: %w", err)
+		}
+		return nil, inspect.CodeInternal, fmt.Errorf("failed to query backend: %w", err)
+	}
+	if resp.StatusCode != 200 {
+		code := errResp.Code
+		if code == "" {
+			code = statusCode(resp.StatusCode)
+		}
+		return nil, code, fmt.Errorf("%s", errResp.Error)
+	}
+	return tags, "", nil
+}
+
+// tagFilter selects tags by regular expression and semantic version range
+type tagFilter struct {
+	pattern    *regexp.Regexp
+	constraint *semver.Constraints
+}
+
+func newTagFilter(pattern, versionRange string) (*tagFilter, error) {
+	f := new(tagFilter)
+	if pattern != "" {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --tag-filter: %w", err)
+		}
+		f.pattern = re
+	}
+	if versionRange != "" {
+		c, err := semver.NewConstraint(versionRange)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --semver range: %w", err)
+		}
+		f.constraint = c
+	}
+	return f, nil
+}
+
+// apply returns the matching tags. With a semver range, tags that aren't
+// versions are skipped and the result is sorted by version; otherwise the
+// registry's order is kept.
+func (f *tagFilter) apply(tags []string) []string {
+	var matched []string
+	versions := make(map[string]*semver.Version)
+	for _, tag := range tags {
+		if f.pattern != nil && !f.pattern.MatchString(tag) {
+			continue
+		}
+		if f.constraint != nil {
+			v, err := semver.NewVersion(tag)
+			if err != nil || !f.constraint.Check(v) {
+				continue
+			}
+			versions[tag] = v
+		}
+		matched = append(matched, tag)
+	}
+	if f.constraint != nil {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return versions[matched[i]].LessThan(versions[matched[j]])
+		})
+	}
+	return matched
+}
+
+// printTagTable prints a row per tag showing whether it is a multi-platform
+// image and the platforms it supports
+func printTagTable(repository string, tags []string, results []inspect.Result) {
+	fmt.Printf("Repository: %s\n", repository)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TAG\tMANIFEST LIST\tDIGEST\tPLATFORMS")
+	for i, result := range results {
+		if result.Image == nil {
+			continue
+		}
+		list := "No"
+		if result.Image.IsList {
+			list = "Yes"
+		}
+		var platforms []string
+		for _, p := range result.Image.ArchList {
+			platforms = append(platforms, parsePlatform(p))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", tags[i], list, result.Image.Digest, strings.Join(platforms, ", "))
+	}
+	w.Flush()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTagFilterApply(t *testing.T) {
+	tags := []string{"latest", "1.10.0", "1.2.0", "1.9.3", "2.0.0", "1.9.3-alpine", "v1.5.0", "edge"}
+	tests := []struct {
+		name         string
+		pattern      string
+		versionRange string
+		want         []string
+	}{
+		{name: "no filter", want: tags},
+		{name: "pattern", pattern: "^1\\.", want: []string{"1.10.0", "1.2.0", "1.9.3", "1.9.3-alpine"}},
+		// versions are sorted, and non-versions and prereleases skipped
+		{name: "semver range", versionRange: ">=1.2.0, <2.0.0", want: []string{"1.2.0", "v1.5.0", "1.9.3", "1.10.0"}},
+		{name: "pattern and range", pattern: "^[0-9]", versionRange: ">=1.5", want: []string{"1.9.3", "1.10.0", "2.0.0"}},
+		{name: "no match", pattern: "^3\\.", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newTagFilter(tt.pattern, tt.versionRange)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.apply(tags); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("apply = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTagFilterErrors(t *testing.T) {
+	if _, err := newTagFilter("(", ""); err == nil {
+		t.Error("newTagFilter accepted an invalid regular expression")
+	}
+	if _, err := newTagFilter("", "not a range"); err == nil {
+		t.Error("newTagFilter accepted an invalid version range")
+	}
+}
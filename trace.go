@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/estesp/mquery/pkg/telemetry"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+var (
+	// rootContext carries the span covering the whole mquery invocation;
+	// all registry and backend queries are made within it
+	rootContext            = context.Background()
+	rootSpan    trace.Span = noop.Span{}
+	// stopTracing flushes the recorded spans
+	stopTracing = func(context.Context) error { return nil }
+)
+
+// startTracing sets up span export as configured by the OTEL_* environment
+// variables and starts the span for this invocation
+func startTracing() error {
+	shutdown, err := telemetry.Setup(context.Background(), "mquery")
+	if err != nil {
+		return err
+	}
+	stopTracing = shutdown
+	name := "mquery"
+	if cmd := flag.Arg(0); cmd == "diff" || cmd == "tags" || cmd == "watch" {
+		name += " " + cmd
+	}
+	rootContext, rootSpan = otel.Tracer("github.com/estesp/mquery").Start(context.Background(), name,
+		trace.WithAttributes(attribute.String("mquery.args", strings.Join(flag.Args(), " "))))
+	return nil
+}
+
+// exit ends the invocation's span, flushes the recorded spans and exits
+func exit(code int) {
+	rootSpan.SetAttributes(attribute.Int("mquery.exit_code", code))
+	rootSpan.End()
+	if err := stopTracing(context.Background()); err != nil {
+		fmt.Fprintf(os.Stderr, "WARN: unable to export traces: %v\n", err)
+	}
+	os.Exit(code)
+}
+
+// tracingDoer sends backend requests within the invocation's span, with the
+// W3C trace context headers so the backend continues the trace
+type tracingDoer struct {
+	client *http.Client
+}
+
+func newTracingDoer(client *http.Client) tracingDoer {
+	c := *client
+	c.Transport = otelhttp.NewTransport(http.DefaultTransport)
+	return tracingDoer{client: &c}
+}
+
+func (d tracingDoer) Do(req *http.Request) (*http.Response, error) {
+	return d.client.Do(req.WithContext(rootContext))
+}
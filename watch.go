@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/estesp/mquery/pkg/inspect"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// watch event types
+const (
+	eventInitial = "initial"
+	eventChanged = "changed"
+	eventError   = "error"
+)
+
+var (
+	watchInterval = flag.Duration("interval", time.Minute, "time between queries (watch command)")
+	watchWebhook  = flag.String("webhook", "", "URL to POST a JSON event to when the image changes (watch command)")
+	watchExec     = flag.String("exec", "", "shell command to run, with the JSON event on stdin, when the image changes (watch command)")
+)
+
+// watchEvent reports the state of a watched image, and for a change, how it
+// differs from the previous state
+type watchEvent struct {
+	Time           time.Time          `json:"time"`
+	Type           string             `json:"type"`
+	Image          string             `json:"image"`
+	Digest         string             `json:"digest"`
+	PreviousDigest string             `json:"previousdigest,omitempty"`
+	Platforms      []ocispec.Platform `json:"platforms"`
+	Added          []ocispec.Platform `json:"added,omitempty"`
+	Removed        []ocispec.Platform `json:"removed,omitempty"`
+}
+
+// watchError reports a failed query or hook; the watch carries on
+type watchError struct {
+	Time  time.Time `json:"time"`
+	Type  string    `json:"type"`
+	Image string    `json:"image"`
+	Error string    `json:"error"`
+}
+
+// watchCommand polls the image, reporting its initial state and any change
+// of digest or platforms. It runs until interrupted or, with --require, until
+// the image supports all the required platforms.
+func watchCommand(args []string) int {
+	if err := parseSubcommand(args, "watch IMAGE", 1); err != nil {
+		printError("%v\n", err)
+		return exitError
+	}
+	if *watchInterval <= 0 {
+		printError("--interval must be positive\n")
+		return exitError
+	}
+	if err := validateOutput(); err != nil {
+		printError("%v\n", err)
+		return exitError
+	}
+	switch {
+	case *formatTmpl != "", *outputFormat == outputText, *outputFormat == outputJSON:
+	default:
+		printError("watch supports text and json output only\n")
+		return exitError
+	}
+	imageName := args[0]
+	var last *Image
+	for {
+		image, err := pollImage(imageName)
+		if err != nil {
+			// keep watching through transient failures
+			printWatchError(imageName, err)
+		} else if last == nil || image.Digest != last.Digest {
+			event := newWatchEvent(imageName, last, image)
+			printWatchEvent(event)
+			if event.Type == eventChanged {
+				runHooks(event)
+			}
+			last = image
+			if len(required) > 0 && len(inspect.MissingPlatforms(required, image.ArchList)) == 0 {
+				return exitOK
+			}
+		}
+		time.Sleep(*watchInterval)
+	}
+}
+
+// pollImage queries the image through the backend or directly
+func pollImage(imageName string) (*Image, error) {
+	results, _, err := queryResults([]string{imageName})
+	if err != nil {
+		return nil, err
+	}
+	if results[0].Error != "" {
+		return nil, fmt.Errorf("%s", results[0].Error)
+	}
+	return results[0].Image, nil
+}
+
+func newWatchEvent(imageName string, previous, current *Image) watchEvent {
+	event := watchEvent{
+		Time:      time.Now().UTC(),
+		Type:      eventInitial,
+		Image:     imageName,
+		Digest:    current.Digest,
+		Platforms: current.ArchList,
+	}
+	if previous != nil {
+		diff := inspect.Compare(previous, current)
+		event.Type = eventChanged
+		event.PreviousDigest = previous.Digest
+		event.Added = diff.Added
+		event.Removed = diff.Removed
+	}
+	return event
+}
+
+// printWatchEvent prints the event as text, as a JSON line with --output
+// json, or using the --format template
+func printWatchEvent(event watchEvent) {
+	if *formatTmpl != "" {
+		if _, err := render(event); err != nil {
+			printWatchError(event.Image, fmt.Errorf("failed to format event: %w", err))
+		}
+		return
+	}
+	if *outputFormat == outputJSON {
+		// one event per line so the output can be streamed to other tools
+		b, _ := json.Marshal(event)
+		fmt.Println(string(b))
+		return
+	}
+	ts := event.Time.Format(time.RFC3339)
+	if event.Type == eventInitial {
+		fmt.Printf("%s %s (digest: %s) supports: %s\n", ts, event.Image, event.Digest, platformsString(event.Platforms))
+		return
+	}
+	fmt.Printf("%s %s changed (digest: %s -> %s)\n", ts, event.Image, event.PreviousDigest, event.Digest)
+	if len(event.Added) > 0 {
+		fmt.Printf(" + %s\n", platformsString(event.Added))
+	}
+	if len(event.Removed) > 0 {
+		fmt.Printf(" - %s\n", platformsString(event.Removed))
+	}
+}
+
+// printWatchError reports an error as an error event with --output json, so
+// the output remains one JSON event per line, or else as an ERROR line
+func printWatchError(imageName string, err error) {
+	if *outputFormat == outputJSON {
+		b, _ := json.Marshal(watchError{
+			Time:  time.Now().UTC(),
+			Type:  eventError,
+			Image: imageName,
+			Error: err.Error(),
+		})
+		fmt.Println(string(b))
+		return
+	}
+	printError("%s: %v\n", imageName, err)
+}
+
+func platformsString(list []ocispec.Platform) string {
+	strs := make([]string, len(list))
+	for i, p := range list {
+		strs[i] = parsePlatform(p)
+	}
+	return strings.Join(strs, ", ")
+}
+
+// runHooks POSTs the event to the --webhook URL and runs the --exec command;
+// failures are reported but don't stop the watch
+func runHooks(event watchEvent) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if *watchWebhook != "" {
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Post(*watchWebhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			printWatchError(event.Image, fmt.Errorf("webhook failed: %w", err))
+		} else {
+			resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				printWatchError(event.Image, fmt.Errorf("webhook returned %s", resp.Status))
+			}
+		}
+	}
+	if *watchExec != "" {
+		cmd := shellCommand(*watchExec)
+		cmd.Stdin = bytes.NewReader(body)
+		cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+		cmd.Env = append(os.Environ(),
+			"MQUERY_IMAGE="+event.Image,
+			"MQUERY_DIGEST="+event.Digest,
+			"MQUERY_PREVIOUS_DIGEST="+event.PreviousDigest,
+		)
+		if err := cmd.Run(); err != nil {
+			printWatchError(event.Image, fmt.Errorf("--exec command failed: %w", err))
+		}
+	}
+}
+
+// shellCommand runs the command line with the platform's shell
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}